@@ -0,0 +1,166 @@
+package mongoconnect
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Pipeline builds an aggregation pipeline one stage at a time:
+// pipeline := Pipeline{}.Match(Where("status").Eq("active")).Group("$country", bson.E{Key: "users", Value: bson.D{{Key: "$sum", Value: 1}}}).Sort("-users").Limit(10)
+// users, err := Aggregate[bson.M](ctx, collection, pipeline)
+// Every method returns a new Pipeline so a Pipeline can be shared and
+// extended safely. A mongo.Pipeline converts to a Pipeline directly.
+type Pipeline []bson.D
+
+// Stage adds the stage(name) with value, for stages without their own method
+func (p Pipeline) Stage(name string, value interface{}) Pipeline {
+	return append(p[:len(p):len(p)], bson.D{{Key: name, Value: value}})
+}
+
+// Match keeps the records matching filter, filter is anything the find
+// helpers accept
+func (p Pipeline) Match(filter interface{}) Pipeline {
+	return p.Stage("$match", filter)
+}
+
+// Group groups the records by the expression(id) and computes the
+// accumulators for each group, for example
+// bson.E{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}}
+func (p Pipeline) Group(id interface{}, accumulators ...bson.E) Pipeline {
+	group := append(bson.D{{Key: "_id", Value: id}}, accumulators...)
+	return p.Stage("$group", group)
+}
+
+// Sort orders the records by fields, a field prefixed with "-" sorts
+// descending
+func (p Pipeline) Sort(fields ...string) Pipeline {
+	return p.Stage("$sort", fieldSpec(fields, -1))
+}
+
+// Project keeps only fields of the records, fields prefixed with "-" are left
+// out instead
+func (p Pipeline) Project(fields ...string) Pipeline {
+	return p.Stage("$project", fieldSpec(fields, 0))
+}
+
+// Lookup adds the records of the collection(from) whose foreignField equals
+// localField as the array field(as)
+func (p Pipeline) Lookup(from, localField, foreignField, as string) Pipeline {
+	return p.Stage("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+// Unwind outputs a record for every element of the array field(path), records
+// with a missing or empty array are kept when preserveEmpty is true
+func (p Pipeline) Unwind(path string, preserveEmpty bool) Pipeline {
+	if !strings.HasPrefix(path, "$") {
+		path = "$" + path
+	}
+	if !preserveEmpty {
+		return p.Stage("$unwind", path)
+	}
+	return p.Stage("$unwind", bson.D{
+		{Key: "path", Value: path},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	})
+}
+
+// Facet runs each of facets on the same records, the result holds a field
+// per facet in name order
+func (p Pipeline) Facet(facets map[string]Pipeline) Pipeline {
+	names := make([]string, 0, len(facets))
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	facet := make(bson.D, 0, len(names))
+	for _, name := range names {
+		facet = append(facet, bson.E{Key: name, Value: facets[name]})
+	}
+	return p.Stage("$facet", facet)
+}
+
+// Skip skips the first n records
+func (p Pipeline) Skip(n int64) Pipeline {
+	return p.Stage("$skip", n)
+}
+
+// Limit passes on at most n records
+func (p Pipeline) Limit(n int64) Pipeline {
+	return p.Stage("$limit", n)
+}
+
+// Aggregate runs pipeline on Collection(collection) and returns the results
+// decoded into T
+func Aggregate[T any](ctx context.Context, collection *mongo.Collection, pipeline Pipeline, opts ...Option) ([]T, error) {
+	cfg := resolve(opts)
+	var results []T
+	err := run(ctx, cfg, OpAggregate, collection, nil, func(ctx context.Context, collection *mongo.Collection, _ interface{}) (int64, error) {
+		// a retry starts over
+		results = nil
+		stages, err := pipeline.normalize()
+		if err != nil {
+			return 0, err
+		}
+		cur, err := collection.Aggregate(ctx, stages, options.Aggregate().SetCollation(cfg.Collation))
+		if err != nil {
+			return 0, err
+		}
+		defer cur.Close(ctx)
+		return decodeEach(ctx, cur, func(result T) error {
+			results = append(results, result)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// normalize returns the stages of the Pipeline with the filters of its $match
+// stages, also those within facets, turned into documents
+func (p Pipeline) normalize() (mongo.Pipeline, error) {
+	stages := make(mongo.Pipeline, len(p))
+	for i, stage := range p {
+		stages[i] = stage
+		if len(stage) != 1 {
+			continue
+		}
+		switch stage[0].Key {
+		case "$match":
+			filter, err := normalizeFilter(stage[0].Value)
+			if err != nil {
+				return nil, err
+			}
+			stages[i] = bson.D{{Key: "$match", Value: filter}}
+		case "$facet":
+			facets, ok := stage[0].Value.(bson.D)
+			if !ok {
+				continue
+			}
+			normalized := make(bson.D, len(facets))
+			for j, facet := range facets {
+				normalized[j] = facet
+				if pipeline, ok := facet.Value.(Pipeline); ok {
+					nested, err := pipeline.normalize()
+					if err != nil {
+						return nil, err
+					}
+					normalized[j].Value = nested
+				}
+			}
+			stages[i] = bson.D{{Key: "$facet", Value: normalized}}
+		}
+	}
+	return stages, nil
+}
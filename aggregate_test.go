@@ -0,0 +1,95 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestPipeline(t *testing.T) {
+	base := mc.Pipeline{}.Match(bson.D{{"status", "active"}})
+	pipeline := base.
+		Lookup("orders", "_id", "userId", "orders").
+		Unwind("orders", false).
+		Group("$country", bson.E{Key: "total", Value: bson.D{{"$sum", "$orders.amount"}}}).
+		Sort("-total", "_id").
+		Project("total", "-_id").
+		Skip(5).
+		Limit(10)
+
+	assert.Equal(t, mc.Pipeline{
+		{{"$match", bson.D{{"status", "active"}}}},
+		{{"$lookup", bson.D{{"from", "orders"}, {"localField", "_id"}, {"foreignField", "userId"}, {"as", "orders"}}}},
+		{{"$unwind", "$orders"}},
+		{{"$group", bson.D{{"_id", "$country"}, {"total", bson.D{{"$sum", "$orders.amount"}}}}}},
+		{{"$sort", bson.D{{"total", -1}, {"_id", 1}}}},
+		{{"$project", bson.D{{"total", 1}, {"_id", 0}}}},
+		{{"$skip", int64(5)}},
+		{{"$limit", int64(10)}},
+	}, pipeline)
+	// extending a pipeline leaves it unchanged
+	assert.Len(t, base, 1)
+
+	assert.Equal(t, mc.Pipeline{{{"$unwind", bson.D{{"path", "$orders"}, {"preserveNullAndEmptyArrays", true}}}}},
+		mc.Pipeline{}.Unwind("$orders", true))
+
+	facet := mc.Pipeline{}.Facet(map[string]mc.Pipeline{
+		"top":   mc.Pipeline{}.Sort("-age").Limit(3),
+		"count": mc.Pipeline{}.Stage("$count", "n"),
+	})
+	assert.Equal(t, mc.Pipeline{{{"$facet", bson.D{
+		{"count", mc.Pipeline{{{"$count", "n"}}}},
+		{"top", mc.Pipeline{{{"$sort", bson.D{{"age", -1}}}}, {{"$limit", int64(3)}}}},
+	}}}}, facet)
+}
+
+func TestAggregate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	type total struct {
+		Country string `bson:"_id"`
+		Users   int    `bson:"users"`
+	}
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch,
+			bson.D{{"_id", "za"}, {"users", 3}},
+			bson.D{{"_id", "nl"}, {"users", 1}},
+		))
+		pipeline := mc.Pipeline{}.
+			Match(mc.Where("status").Eq("active")).
+			Facet(map[string]mc.Pipeline{"john": mc.Pipeline{}.Match(mc.Filter{}.Eq("name", "john"))}).
+			Group("$country", bson.E{Key: "users", Value: bson.D{{"$sum", 1}}})
+		results, err := mc.Aggregate[total](ctx, mt.Coll, pipeline)
+		assert.Nil(t, err)
+		assert.Equal(t, []total{{"za", 3}, {"nl", 1}}, results)
+
+		// the builder filters are sent as documents
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(t, "active", cmd.Lookup("pipeline", "0", "$match", "status").StringValue())
+		assert.Equal(t, "john", cmd.Lookup("pipeline", "1", "$facet", "john", "0", "$match", "name").StringValue())
+	})
+
+	mt.Run("invalid filter", func(mt *mtest.T) {
+		_, err := mc.Aggregate[bson.M](ctx, mt.Coll, mc.Pipeline{}.Match("name"))
+		assert.ErrorIs(t, err, mc.ErrInvalidFilter)
+	})
+
+	mt.Run("server error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    40324,
+			Message: "Unrecognized pipeline stage name",
+		}))
+		_, err := mc.Aggregate[bson.M](ctx, mt.Coll, mc.Pipeline{}.Stage("$bogus", 1))
+		var opErr *mc.OpError
+		assert.ErrorAs(t, err, &opErr)
+		assert.Equal(t, mc.OpAggregate, opErr.Op)
+	})
+}
@@ -0,0 +1,186 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Defaults of BatchOptions
+const (
+	DefaultBatchDocs        = 1000
+	DefaultBatchBytes       = 8 << 20
+	DefaultBatchConcurrency = 4
+)
+
+// BatchOptions sets how CreateEntriesBatched splits and sends its records
+type BatchOptions struct {
+	// MaxDocs is the most records in a chunk, DefaultBatchDocs when zero
+	MaxDocs int
+	// MaxBytes is the most BSON bytes in a chunk, DefaultBatchBytes when
+	// zero. A record larger than MaxBytes gets a chunk of its own.
+	MaxBytes int
+	// Concurrency is the number of chunks sent at once,
+	// DefaultBatchConcurrency when zero
+	Concurrency int
+	// Progress is called after every chunk with the number of records done,
+	// added or failed, out of total. Calls do not overlap.
+	Progress func(done, total int)
+}
+
+// CreateEntriesBatched adds records(docs) into Collection(collection) in
+// chunks split by record count and size, sending several chunks at once:
+// ids, err := CreateEntriesBatched(ctx, collection, docs, BatchOptions{Progress: func(done, total int) { log.Println(done, "of", total) }})
+// Every chunk is bounded by the timeout of OpCreateEntries, the whole batch
+// only by ctx. The ids are in the order of docs, when some records fail the
+// error holds a BatchError with their positions in docs and their ids are
+// nil. With WithOrdered the chunks are sent one at a time and the batch stops
+// at the first failure.
+func CreateEntriesBatched(ctx context.Context, collection *mongo.Collection, docs []interface{}, batch BatchOptions, opts ...Option) ([]interface{}, error) {
+	cfg := resolve(opts)
+	if batch.MaxDocs <= 0 {
+		batch.MaxDocs = DefaultBatchDocs
+	}
+	if batch.MaxBytes <= 0 {
+		batch.MaxBytes = DefaultBatchBytes
+	}
+	if batch.Concurrency <= 0 {
+		batch.Concurrency = DefaultBatchConcurrency
+	}
+	if cfg.Ordered {
+		batch.Concurrency = 1
+	}
+
+	ids := make([]interface{}, len(docs))
+	err := run(ctx, cfg, OpCreateEntriesBatched, collection, nil, func(ctx context.Context, collection *mongo.Collection, _ interface{}) (int64, error) {
+		if len(docs) == 0 {
+			return 0, mongo.ErrEmptySlice
+		}
+		var (
+			mu       sync.Mutex
+			failed   = make(map[int]error)
+			firstErr error
+			done     int
+			inserted int64
+			stop     bool
+			wg       sync.WaitGroup
+			sem      = make(chan struct{}, batch.Concurrency)
+		)
+		// report records the outcome of the chunk of docs starting at start
+		report := func(start int, chunkIDs []interface{}, size int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			copy(ids[start:], chunkIDs)
+			for _, id := range chunkIDs {
+				if id != nil {
+					inserted++
+				}
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				var batchErr *BatchError
+				if errors.As(err, &batchErr) {
+					for i, recordErr := range batchErr.Errors {
+						failed[start+i] = recordErr
+					}
+				} else {
+					for i := 0; i < size; i++ {
+						failed[start+i] = err
+					}
+				}
+				stop = stop || cfg.Ordered
+			}
+			done += size
+			if batch.Progress != nil {
+				batch.Progress(done, len(docs))
+			}
+		}
+
+		for start := 0; start < len(docs); {
+			// the chunks are split as they are sent, so only the records
+			// in flight are measured
+			c := nextChunk(docs, start, batch.MaxDocs, batch.MaxBytes)
+			start += len(c.docs)
+			sem <- struct{}{}
+			mu.Lock()
+			stopped := stop
+			mu.Unlock()
+			if stopped || ctx.Err() != nil {
+				<-sem
+				break
+			}
+			wg.Add(1)
+			go func(c chunk) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if c.err != nil {
+					report(c.start, nil, len(c.docs), c.err)
+					return
+				}
+				chunkIDs, err := CreateEntriesCtx(ctx, collection, c.docs, opts...)
+				report(c.start, chunkIDs, len(c.docs), err)
+			}(c)
+		}
+		wg.Wait()
+
+		if done < len(docs) {
+			// the chunks that were not sent, because ctx is done or an
+			// ordered batch stopped at its first failure
+			reason := ctx.Err()
+			if reason == nil {
+				reason = ErrNotAttempted
+			}
+			for i := range docs {
+				if _, ok := failed[i]; !ok && ids[i] == nil {
+					failed[i] = reason
+				}
+			}
+			if firstErr == nil {
+				firstErr = reason
+			}
+		}
+		if firstErr != nil {
+			return inserted, &BatchError{Errors: failed, Err: firstErr}
+		}
+		return inserted, nil
+	})
+	return ids, err
+}
+
+// chunk is a part of a batch, start is the position of its first record in
+// the batch. A record that can not be marshalled gets a chunk of its own with
+// the error(err).
+type chunk struct {
+	start int
+	docs  []interface{}
+	err   error
+}
+
+// nextChunk returns the chunk of docs from position start on, of at most
+// maxDocs records and maxBytes BSON bytes. The records are marshalled only to
+// measure them, the driver encodes them as they are with the registry of the
+// collection.
+func nextChunk(docs []interface{}, start, maxDocs, maxBytes int) chunk {
+	end, size := start, 0
+	for ; end < len(docs) && end-start < maxDocs; end++ {
+		raw, err := bson.Marshal(docs[end])
+		if err != nil {
+			if end == start {
+				return chunk{start: start, docs: docs[start : start+1], err: fmt.Errorf("could not marshal record: %w", err)}
+			}
+			// it gets a chunk of its own
+			break
+		}
+		if end > start && size+len(raw) > maxBytes {
+			break
+		}
+		size += len(raw)
+	}
+	return chunk{start: start, docs: docs[start:end]}
+}
@@ -0,0 +1,117 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestCreateEntriesBatched(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	docs := make([]interface{}, 5)
+	for i := range docs {
+		docs[i] = bson.D{{"name", "john"}, {"seq", i}}
+	}
+
+	mt.Run("chunks by count", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		var progress []int
+		ids, err := mc.CreateEntriesBatched(ctx, mt.Coll, docs, mc.BatchOptions{
+			MaxDocs:     2,
+			Concurrency: 1,
+			Progress: func(done, total int) {
+				assert.Equal(t, 5, total)
+				progress = append(progress, done)
+			},
+		})
+		assert.Nil(t, err)
+		assert.Len(t, ids, 5)
+		assert.NotContains(t, ids, nil)
+		assert.Equal(t, []int{2, 4, 5}, progress)
+		for _, n := range []int{2, 2, 1} {
+			documents, _ := mt.GetStartedEvent().Command.Lookup("documents").Array().Values()
+			assert.Len(t, documents, n)
+		}
+	})
+
+	mt.Run("chunks by size", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		size := len(mustMarshal(t, docs[0]))
+		ids, err := mc.CreateEntriesBatched(ctx, mt.Coll, docs[:3], mc.BatchOptions{MaxBytes: 2*size + 1, Concurrency: 1})
+		assert.Nil(t, err)
+		assert.Len(t, ids, 3)
+		assert.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+		assert.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("partly failed", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			bson.D{{"ok", 1}, {"n", 1}, {"writeErrors", bson.A{
+				bson.D{{"index", 1}, {"code", 11000}, {"errmsg", "duplicate key error"}},
+			}}},
+			mtest.CreateSuccessResponse(),
+		)
+		batch := append([]interface{}{"not a document"}, docs...)
+		ids, err := mc.CreateEntriesBatched(ctx, mt.Coll, batch, mc.BatchOptions{MaxDocs: 2, Concurrency: 1})
+		var batchErr *mc.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, []int{0, 4}, batchErr.Failed())
+		assert.True(t, mongo.IsDuplicateKeyError(batchErr.Errors[4]))
+		assert.Nil(t, ids[0])
+		assert.NotNil(t, ids[3])
+		assert.Nil(t, ids[4])
+		assert.NotNil(t, ids[5])
+	})
+
+	mt.Run("ordered", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			bson.D{{"ok", 1}, {"n", 0}, {"writeErrors", bson.A{
+				bson.D{{"index", 0}, {"code", 11000}, {"errmsg", "duplicate key error"}},
+			}}},
+		)
+		ids, err := mc.CreateEntriesBatched(ctx, mt.Coll, docs, mc.BatchOptions{MaxDocs: 2}, mc.WithOrdered())
+		var batchErr *mc.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		// the records after the failure were not tried
+		assert.Equal(t, []int{2, 3, 4}, batchErr.Failed())
+		assert.ErrorIs(t, batchErr.Errors[3], mc.ErrNotAttempted)
+		assert.ErrorIs(t, batchErr.Errors[4], mc.ErrNotAttempted)
+		assert.Equal(t, []bool{true, true, false, false, false}, []bool{ids[0] != nil, ids[1] != nil, ids[2] != nil, ids[3] != nil, ids[4] != nil})
+		mt.GetStartedEvent()
+		mt.GetStartedEvent()
+		// the batch stopped at the failure
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("cancelled", func(mt *mtest.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		ids, err := mc.CreateEntriesBatched(ctx, mt.Coll, docs, mc.BatchOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+		var batchErr *mc.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		assert.Len(t, batchErr.Failed(), 5)
+		assert.Equal(t, make([]interface{}, 5), ids)
+	})
+}
+
+// mustMarshal returns doc as BSON
+func mustMarshal(t *testing.T, doc interface{}) []byte {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
@@ -0,0 +1,242 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BatchError reports the records of a batch write that failed by their
+// position in the batch, the other records were written. The records of an
+// ordered batch after its first failure were not tried, they are reported with
+// ErrNotAttempted. Retry the records at Failed() to complete the batch:
+// var batchErr *BatchError
+// if errors.As(err, &batchErr) { retry(batchErr.Failed()) }
+type BatchError struct {
+	// Errors maps the position of every failed record to its error
+	Errors map[int]error
+	// Err is the error of the batch as the driver reported it
+	Err error
+}
+
+// Error describes how many records failed and why
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d records failed: %v", len(e.Errors), e.Err)
+}
+
+// Unwrap returns the error of the batch
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Failed returns the positions of the failed records in ascending order
+func (e *BatchError) Failed() []int {
+	failed := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		failed = append(failed, i)
+	}
+	sort.Ints(failed)
+	return failed
+}
+
+// batchError turns the write errors of a batch of size records in err into a
+// BatchError, other errors are returned as they are. The records of an
+// ordered batch after the first failure are reported with ErrNotAttempted.
+func batchError(err error, size int, ordered bool) error {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		return err
+	}
+	failed := make(map[int]error, len(bulkErr.WriteErrors))
+	first := size
+	for _, writeErr := range bulkErr.WriteErrors {
+		failed[writeErr.Index] = writeErr.WriteError
+		if writeErr.Index < first {
+			first = writeErr.Index
+		}
+	}
+	if ordered {
+		for i := first + 1; i < size; i++ {
+			if _, ok := failed[i]; !ok {
+				failed[i] = ErrNotAttempted
+			}
+		}
+	}
+	return &BatchError{Errors: failed, Err: err}
+}
+
+// resumeBatch writes the size records of a batch with send, which sends the
+// records from position start on and reports their failures in a BatchError.
+// On a retry(retried) a record failing as a duplicate of the _id it was
+// given(assigned) was added by an attempt whose outcome was lost, it counts as
+// written and an ordered batch goes on after it. It returns the number of
+// such records.
+func resumeBatch(size int, ordered, retried bool, assigned []interface{}, send func(start int) error) (int64, error) {
+	failed := make(map[int]error)
+	var (
+		last    error
+		resumed int64
+	)
+	for start := 0; start < size; {
+		err := send(start)
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) {
+			if err != nil {
+				return resumed, err
+			}
+			break
+		}
+		last = batchErr.Err
+		next := size
+		for i, recordErr := range batchErr.Errors {
+			if retried && assigned[start+i] != nil && isDuplicateID(recordErr) {
+				resumed++
+				if ordered {
+					next = start + i + 1
+				}
+				continue
+			}
+			failed[start+i] = recordErr
+		}
+		if next == size {
+			break
+		}
+		// the records the duplicate stopped were not attempted, send them
+		for i := next; i < size; i++ {
+			delete(failed, i)
+		}
+		start = next
+	}
+	if len(failed) == 0 {
+		return resumed, nil
+	}
+	return resumed, &BatchError{Errors: failed, Err: last}
+}
+
+// BulkWrite sends the inserts, updates, replaces and deletes of models to
+// Collection(collection) in one batch, see BulkWriteCtx
+func BulkWrite(collection *mongo.Collection, models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	return BulkWriteCtx(context.Background(), collection, models)
+}
+
+// BulkWriteCtx sends the inserts, updates, replaces and deletes of models to
+// Collection(collection) in one batch within the caller's context(ctx):
+// res, err := BulkWriteCtx(ctx, collection, []mongo.WriteModel{
+// mongo.NewInsertOneModel().SetDocument(doc),
+// mongo.NewUpdateOneModel().SetFilter(Where("name").Eq("john")).SetUpdate(update),
+// mongo.NewDeleteManyModel().SetFilter(Filter{}.Lt("age", 18)),
+// })
+// The filters of the models take anything the other helpers accept. The batch
+// is unordered unless WithOrdered is given, records that fail are reported in
+// a BatchError and the result counts the others.
+func BulkWriteCtx(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel, opts ...Option) (*mongo.BulkWriteResult, error) {
+	var res *mongo.BulkWriteResult
+	cfg := resolve(opts)
+	// normalized once so a retry inserts the records under the same ids
+	normalized, assigned, err := normalizeModels(models, cfg)
+	if err != nil {
+		return nil, opError(OpBulkWrite, collection, nil, err)
+	}
+	attempt := 0
+	err = run(ctx, cfg, OpBulkWrite, collection, nil, func(ctx context.Context, collection *mongo.Collection, _ interface{}) (int64, error) {
+		attempt++
+		res = nil
+		opts := options.BulkWrite().SetOrdered(cfg.Ordered)
+		resumed, err := resumeBatch(len(normalized), cfg.Ordered, attempt > 1, assigned, func(start int) error {
+			part, err := collection.BulkWrite(ctx, normalized[start:], opts)
+			res = mergeBulkResult(res, part, start)
+			return batchError(err, len(normalized)-start, cfg.Ordered)
+		})
+		if res == nil {
+			return 0, err
+		}
+		res.InsertedCount += resumed
+		// a partly failed batch still reports what was written
+		return res.InsertedCount + res.ModifiedCount + res.UpsertedCount + res.DeletedCount, err
+	})
+	return res, err
+}
+
+// mergeBulkResult adds part, the result of the models of a batch from
+// position start on, to res
+func mergeBulkResult(res, part *mongo.BulkWriteResult, start int) *mongo.BulkWriteResult {
+	if part == nil {
+		return res
+	}
+	if res == nil {
+		res = &mongo.BulkWriteResult{UpsertedIDs: make(map[int64]interface{})}
+	}
+	res.InsertedCount += part.InsertedCount
+	res.MatchedCount += part.MatchedCount
+	res.ModifiedCount += part.ModifiedCount
+	res.DeletedCount += part.DeletedCount
+	res.UpsertedCount += part.UpsertedCount
+	for i, id := range part.UpsertedIDs {
+		res.UpsertedIDs[i+int64(start)] = id
+	}
+	return res
+}
+
+// normalizeModels returns copies of models with their filters turned into
+// documents and the collation of cfg applied. When cfg retries the records
+// inserted get an _id when they have none, the ids given are returned by the
+// position of their model.
+func normalizeModels(models []mongo.WriteModel, cfg Config) ([]mongo.WriteModel, []interface{}, error) {
+	out := make([]mongo.WriteModel, len(models))
+	assigned := make([]interface{}, len(models))
+	for i, model := range models {
+		var filter *interface{}
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			if cfg.Retry.MaxAttempts <= 1 {
+				out[i] = model
+				continue
+			}
+			c := *m
+			c.Document, assigned[i] = withID(c.Document)
+			out[i] = &c
+			continue
+		case *mongo.UpdateOneModel:
+			c := *m
+			c.Collation = collationOr(c.Collation, cfg)
+			filter, out[i] = &c.Filter, &c
+		case *mongo.UpdateManyModel:
+			c := *m
+			c.Collation = collationOr(c.Collation, cfg)
+			filter, out[i] = &c.Filter, &c
+		case *mongo.ReplaceOneModel:
+			c := *m
+			c.Collation = collationOr(c.Collation, cfg)
+			filter, out[i] = &c.Filter, &c
+		case *mongo.DeleteOneModel:
+			c := *m
+			c.Collation = collationOr(c.Collation, cfg)
+			filter, out[i] = &c.Filter, &c
+		case *mongo.DeleteManyModel:
+			c := *m
+			c.Collation = collationOr(c.Collation, cfg)
+			filter, out[i] = &c.Filter, &c
+		default:
+			out[i] = model
+			continue
+		}
+		normalized, err := normalizeFilter(*filter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("model %d: %w", i, err)
+		}
+		*filter = normalized
+	}
+	return out, assigned, nil
+}
+
+// collationOr returns collation, or the collation of cfg when it is nil
+func collationOr(collation *options.Collation, cfg Config) *options.Collation {
+	if collation != nil {
+		return collation
+	}
+	return cfg.Collation
+}
@@ -0,0 +1,67 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestBulkWrite(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	models := []mongo.WriteModel{
+		mongo.NewInsertOneModel().SetDocument(bson.D{{"name", "john"}}),
+		mongo.NewUpdateOneModel().SetFilter(mc.Where("name").Eq("jane")).SetUpdate(bson.D{{"$set", bson.D{{"age", 30}}}}),
+		mongo.NewDeleteManyModel().SetFilter(mc.Filter{}.Lt("age", 18)),
+	}
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"n", 1}},
+			bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}},
+			bson.D{{"ok", 1}, {"n", 2}},
+		)
+		res, err := mc.BulkWriteCtx(context.Background(), mt.Coll, models, mc.WithOrdered())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.InsertedCount)
+		assert.Equal(t, int64(1), res.ModifiedCount)
+		assert.Equal(t, int64(2), res.DeletedCount)
+
+		// the builder filters are sent as documents
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command
+		assert.Equal(t, "jane", update.Lookup("updates", "0", "q", "name").StringValue())
+		assert.True(t, update.Lookup("ordered").Boolean())
+		remove := mt.GetStartedEvent().Command
+		assert.Equal(t, int32(18), remove.Lookup("deletes", "0", "q", "age", "$lt").Int32())
+	})
+
+	mt.Run("partly failed", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"n", 0}, {"writeErrors", bson.A{
+				bson.D{{"index", 0}, {"code", 11000}, {"errmsg", "duplicate key error"}},
+			}}},
+			bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}},
+			bson.D{{"ok", 1}, {"n", 2}},
+		)
+		res, err := mc.BulkWrite(mt.Coll, models)
+		assert.ErrorIs(t, err, mc.ErrDuplicateKey)
+		var batchErr *mc.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, []int{0}, batchErr.Failed())
+		assert.Equal(t, int64(0), res.InsertedCount)
+		assert.Equal(t, int64(2), res.DeletedCount)
+	})
+
+	mt.Run("invalid filter", func(mt *mtest.T) {
+		_, err := mc.BulkWrite(mt.Coll, []mongo.WriteModel{mongo.NewDeleteOneModel().SetFilter("john")})
+		assert.ErrorIs(t, err, mc.ErrInvalidFilter)
+	})
+}
@@ -0,0 +1,229 @@
+package mongoconnect
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// Config holds the settings the helpers run with. The package defaults are
+// changed with Configure or SetConfig, a single call is changed by passing
+// Options to the Ctx variants of the helpers, for example:
+// mongoconnect.Configure(mongoconnect.WithOperationTimeout(mongoconnect.OpRemoveMany, time.Minute))
+// items, err := mongoconnect.FindManyItemsCtx(ctx, collection, filter, mongoconnect.WithTimeout(time.Second))
+type Config struct {
+	// Timeout bounds every operation without an entry in Timeouts, zero
+	// leaves the operation bounded only by the caller's context
+	Timeout time.Duration
+	// Timeouts bounds the operations by their Op name
+	Timeouts map[string]time.Duration
+	// Collation is used to match records in the read, delete and update
+	// helpers, nil leaves matching to the collection's default collation
+	Collation *options.Collation
+	// Ordered writes the records of a batch in order and stops at the first
+	// failure, by default every record is tried
+	Ordered bool
+	// PruneIndexes drops the indexes EnsureIndexes finds missing from its
+	// specs, by default they are kept
+	PruneIndexes bool
+	// Retry runs the operations again on transient failures, the zero
+	// RetryPolicy runs them once
+	Retry RetryPolicy
+	// ReadPreference picks the servers the reads and CheckConnection go to,
+	// nil leaves it to the collection
+	ReadPreference *readpref.ReadPref
+	// ReadConcern sets the isolation of the reads, nil leaves it to the
+	// collection
+	ReadConcern *readconcern.ReadConcern
+	// WriteConcern sets the acknowledgement the writes wait for, nil leaves
+	// it to the collection
+	WriteConcern *writeconcern.WriteConcern
+}
+
+// Option changes a Config
+type Option func(*Config)
+
+// WithTimeout sets the timeout of the operations without their own timeout
+func WithTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = d
+	}
+}
+
+// WithOperationTimeout sets the timeout of the operation(op), op is one of the
+// Op names such as OpFindManyItems
+func WithOperationTimeout(op string, d time.Duration) Option {
+	return func(c *Config) {
+		// copy so the change does not leak into the Config it was copied from
+		timeouts := make(map[string]time.Duration, len(c.Timeouts)+1)
+		for k, v := range c.Timeouts {
+			timeouts[k] = v
+		}
+		timeouts[op] = d
+		c.Timeouts = timeouts
+	}
+}
+
+// WithCollation sets the collation used to match records, for example to
+// match "Bob" and "bob" alike:
+// WithCollation(&options.Collation{Locale: "en_US", Strength: 1})
+// Indexes are only used for the match when built with the same collation.
+func WithCollation(collation *options.Collation) Option {
+	return func(c *Config) {
+		c.Collation = collation
+	}
+}
+
+// WithOrdered writes the records of CreateEntries and BulkWrite batches in
+// order, stopping at the first record that fails
+func WithOrdered() Option {
+	return func(c *Config) {
+		c.Ordered = true
+	}
+}
+
+// WithReadPreference sets the servers the reads go to, for example to send
+// analytics to nearby secondaries no more than 90 seconds behind:
+// WithReadPreference(readpref.SecondaryPreferred(readpref.WithTags("dc", "east"), readpref.WithMaxStaleness(90*time.Second)))
+func WithReadPreference(rp *readpref.ReadPref) Option {
+	return func(c *Config) {
+		c.ReadPreference = rp
+	}
+}
+
+// WithReadConcern sets the isolation of the reads, for example to read only
+// what a majority of the replica set has written:
+// WithReadConcern(readconcern.Majority())
+func WithReadConcern(rc *readconcern.ReadConcern) Option {
+	return func(c *Config) {
+		c.ReadConcern = rc
+	}
+}
+
+// WithWriteConcern sets the acknowledgement the writes wait for, for example
+// the journal of a majority of the replica set within 5 seconds:
+// WithWriteConcern(writeconcern.New(writeconcern.WMajority(), writeconcern.J(true), writeconcern.WTimeout(5*time.Second)))
+func WithWriteConcern(wc *writeconcern.WriteConcern) Option {
+	return func(c *Config) {
+		c.WriteConcern = wc
+	}
+}
+
+// WithPruneIndexes drops the indexes of a collection that EnsureIndexes and
+// EnsureModel find missing from their specs
+func WithPruneIndexes() Option {
+	return func(c *Config) {
+		c.PruneIndexes = true
+	}
+}
+
+// DefaultConfig returns the settings the package starts with
+func DefaultConfig() Config {
+	return Config{
+		Timeout: 5 * time.Second,
+		Timeouts: map[string]time.Duration{
+			OpCheckConnection: 2 * time.Second,
+			OpHealth:          2 * time.Second,
+			OpCreateEntries:   20 * time.Second,
+			OpBulkWrite:       20 * time.Second,
+			OpAllItems:        30 * time.Second,
+			OpFindManyItems:   30 * time.Second,
+			OpFindPage:        30 * time.Second,
+			OpAggregate:       30 * time.Second,
+			OpCount:           30 * time.Second,
+			OpDistinct:        30 * time.Second,
+			OpTransaction:     2 * time.Minute,
+			OpRemoveOne:       2 * time.Second,
+			OpRemoveMany:      2 * time.Second,
+			OpUpdateMany:      20 * time.Second,
+			// streams run as long as their caller reads
+			OpForEach: 0,
+			// index builds take as long as the collection is large
+			OpEnsureIndexes: 0,
+			// the chunks of a batch have the timeout of OpCreateEntries each
+			OpCreateEntriesBatched: 0,
+		},
+	}
+}
+
+var (
+	configMu  sync.RWMutex
+	pkgConfig = DefaultConfig()
+)
+
+// CurrentConfig returns the package defaults in use
+func CurrentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return pkgConfig
+}
+
+// SetConfig replaces the package defaults with c
+func SetConfig(c Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	pkgConfig = c
+}
+
+// Configure applies opts to the package defaults
+func Configure(opts ...Option) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	for _, opt := range opts {
+		opt(&pkgConfig)
+	}
+}
+
+// resolve returns the package defaults with opts applied
+func resolve(opts []Option) Config {
+	c := CurrentConfig()
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// timeout returns the timeout of the operation(op)
+func (c Config) timeout(op string) time.Duration {
+	if d, ok := c.Timeouts[op]; ok {
+		return d
+	}
+	return c.Timeout
+}
+
+// withTimeout bounds ctx by the timeout of the operation(op), the deadline of
+// ctx still applies when it is earlier
+func (c Config) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	if d := c.timeout(op); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// collectionOptions returns the read preference, read concern and write
+// concern c sets in the form of collection options, nil when c sets none
+func (c Config) collectionOptions() *options.CollectionOptions {
+	if c.ReadPreference == nil && c.ReadConcern == nil && c.WriteConcern == nil {
+		return nil
+	}
+	return options.Collection().
+		SetReadPreference(c.ReadPreference).
+		SetReadConcern(c.ReadConcern).
+		SetWriteConcern(c.WriteConcern)
+}
+
+// collection returns collection with the read preference, read concern and
+// write concern c sets, collection itself when c sets none
+func (c Config) collection(collection *mongo.Collection) (*mongo.Collection, error) {
+	opts := c.collectionOptions()
+	if opts == nil {
+		return collection, nil
+	}
+	return collection.Clone(opts)
+}
@@ -0,0 +1,162 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestConfigure(t *testing.T) {
+	defer mc.SetConfig(mc.CurrentConfig())
+
+	mc.SetConfig(mc.DefaultConfig())
+	assert.Equal(t, 5*time.Second, mc.CurrentConfig().Timeout)
+	assert.Equal(t, 2*time.Second, mc.CurrentConfig().Timeouts[mc.OpRemoveOne])
+	// both batch writes get the same time
+	assert.Equal(t, mc.CurrentConfig().Timeouts[mc.OpCreateEntries], mc.CurrentConfig().Timeouts[mc.OpBulkWrite])
+
+	mc.Configure(mc.WithTimeout(time.Second), mc.WithOperationTimeout(mc.OpRemoveMany, time.Minute))
+	cfg := mc.CurrentConfig()
+	assert.Equal(t, time.Second, cfg.Timeout)
+	assert.Equal(t, time.Minute, cfg.Timeouts[mc.OpRemoveMany])
+	// the built in defaults are left alone
+	assert.Equal(t, 2*time.Second, mc.DefaultConfig().Timeouts[mc.OpRemoveMany])
+}
+
+func TestOperationTimeout(t *testing.T) {
+	// nothing listens on port 1 so server selection blocks until the timeout
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	coll := client.Database("testdb").Collection("users")
+
+	start := time.Now()
+	_, err = mc.FindManyItemsCtx(context.Background(), coll, bson.D{{"name", "john"}},
+		mc.WithOperationTimeout(mc.OpFindManyItems, 100*time.Millisecond))
+	assert.ErrorIs(t, err, mc.ErrTimeout)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestWithCollation(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	filter := bson.D{{"name", "bob"}}
+
+	mt.Run("default server collation", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 1}})
+		_, err := mc.RemoveOneCtx(context.Background(), mt.Coll, filter)
+		assert.Nil(t, err)
+
+		_, err = mt.GetStartedEvent().Command.LookupErr("deletes", "0", "collation")
+		assert.NotNil(t, err, "no collation expected")
+	})
+
+	mt.Run("case insensitive", func(mt *mtest.T) {
+		caseInsensitive := mc.WithCollation(&options.Collation{Locale: "en_US", Strength: 1})
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 1}},
+			mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch),
+		)
+		_, err := mc.RemoveManyCtx(context.Background(), mt.Coll, filter, caseInsensitive)
+		assert.Nil(t, err)
+		collation := mt.GetStartedEvent().Command.Lookup("deletes", "0", "collation").Document()
+		assert.Equal(t, "en_US", collation.Lookup("locale").StringValue())
+		assert.Equal(t, int32(1), collation.Lookup("strength").Int32())
+
+		// finds match the same records as deletes
+		_, err = mc.FindManyItemsCtx(context.Background(), mt.Coll, filter, caseInsensitive)
+		assert.Nil(t, err)
+		collation = mt.GetStartedEvent().Command.Lookup("collation").Document()
+		assert.Equal(t, "en_US", collation.Lookup("locale").StringValue())
+	})
+}
+
+func TestReadAndWriteConcern(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+	filter := bson.D{{"name", "bob"}}
+
+	mt.Run("write concern", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+		wc := writeconcern.New(writeconcern.W(2), writeconcern.J(true), writeconcern.WTimeout(5*time.Second))
+		_, err := mc.CreateEntryCtx(ctx, mt.Coll, bson.D{{"name", "bob"}}, mc.WithWriteConcern(wc))
+		assert.Nil(t, err)
+		concern := mt.GetStartedEvent().Command.Lookup("writeConcern").Document()
+		assert.Equal(t, int64(2), concern.Lookup("w").AsInt64())
+		assert.True(t, concern.Lookup("j").Boolean())
+		assert.Equal(t, int64(5000), concern.Lookup("wtimeout").AsInt64())
+
+		// the collection keeps its own write concern
+		_, err = mc.RemoveOneCtx(ctx, mt.Coll, filter)
+		assert.Nil(t, err)
+		concern, _ = mt.GetStartedEvent().Command.Lookup("writeConcern").DocumentOK()
+		_, err = concern.LookupErr("j")
+		assert.NotNil(t, err, "no journal expected")
+	})
+
+	mt.Run("update write concern", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		wc := writeconcern.New(writeconcern.W(3), writeconcern.J(true))
+		update := bson.D{{"$set", bson.D{{"age", 30}}}}
+		_, err := mc.UpdateOneCtx(ctx, mt.Coll, filter, update, mc.WithWriteConcern(wc))
+		assert.Nil(t, err)
+		concern := mt.GetStartedEvent().Command.Lookup("writeConcern").Document()
+		assert.Equal(t, int64(3), concern.Lookup("w").AsInt64())
+		assert.True(t, concern.Lookup("j").Boolean())
+
+		_, err = mc.UpsertCtx(ctx, mt.Coll, filter, update, mc.WithWriteConcern(wc))
+		assert.Nil(t, err)
+		concern = mt.GetStartedEvent().Command.Lookup("writeConcern").Document()
+		assert.Equal(t, int64(3), concern.Lookup("w").AsInt64())
+	})
+
+	mt.Run("read concern", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		_, err := mc.FindManyItemsCtx(ctx, mt.Coll, filter, mc.WithReadConcern(readconcern.Majority()))
+		assert.Nil(t, err)
+		level := mt.GetStartedEvent().Command.Lookup("readConcern", "level").StringValue()
+		assert.Equal(t, "majority", level)
+	})
+
+	mt.Run("read preference", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		rp, err := readpref.New(readpref.SecondaryPreferredMode,
+			readpref.WithTags("dc", "east"), readpref.WithMaxStaleness(90*time.Second))
+		assert.Nil(t, err)
+		_, err = mc.CountCtx(ctx, mt.Coll, filter, mc.WithReadPreference(rp))
+		assert.Nil(t, err)
+		pref := mt.GetStartedEvent().Command.Lookup("$readPreference").Document()
+		assert.Equal(t, "secondaryPreferred", pref.Lookup("mode").StringValue())
+		assert.Equal(t, "east", pref.Lookup("tags", "0", "dc").StringValue())
+		assert.Equal(t, int64(90), pref.Lookup("maxStalenessSeconds").AsInt64())
+	})
+
+	mt.Run("check connection", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		assert.True(t, mc.CheckConnectionCtx(ctx, mt.Client, mc.WithReadPreference(readpref.Nearest())))
+		pref := mt.GetStartedEvent().Command.Lookup("$readPreference", "mode").StringValue()
+		assert.Equal(t, "nearest", pref)
+	})
+}
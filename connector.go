@@ -0,0 +1,122 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Connector owns a mongo client, a default database and the named collections
+// opened on that database. Several connectors can coexist in one process, each
+// with its own lifecycle.
+type Connector struct {
+	dbName string
+	dbOpts *options.DatabaseOptions
+
+	mu          sync.RWMutex
+	client      *mongo.Client
+	database    *mongo.Database
+	collections map[string]*mongo.Collection
+}
+
+// NewConnector returns an unconnected Connector that will use the database
+// dbName as its default database. The read preference, read concern and write
+// concern of opts become the defaults of the database and its collections,
+// the other settings of opts do not apply to a Connector:
+// analytics := NewConnector("shop", WithReadPreference(readpref.SecondaryPreferred()))
+func NewConnector(dbName string, opts ...Option) *Connector {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Connector{
+		dbName: dbName,
+		dbOpts: options.Database().
+			SetReadPreference(cfg.ReadPreference).
+			SetReadConcern(cfg.ReadConcern).
+			SetWriteConcern(cfg.WriteConcern),
+		collections: make(map[string]*mongo.Collection),
+	}
+}
+
+// Connect creates the client for the connection string(uri) and opens the
+// default database. Options in opts are applied after the uri so they can
+// override it. Calling Connect does not block for server discovery, use
+// CheckConnection to verify the server is reachable.
+func (c *Connector) Connect(ctx context.Context, uri string, opts ...*options.ClientOptions) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		return errors.New("connector is already connected")
+	}
+
+	clientOpts := append([]*options.ClientOptions{options.Client().ApplyURI(uri)}, opts...)
+	client, err := mongo.Connect(ctx, clientOpts...)
+	if err != nil {
+		return fmt.Errorf("could not connect to mongodb with error: %w", err)
+	}
+	c.client = client
+	c.database = client.Database(c.dbName, c.dbOpts)
+	return nil
+}
+
+// Close disconnects the client and forgets the opened collections. Closing an
+// unconnected Connector is a no-op.
+func (c *Connector) Close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		return nil
+	}
+
+	err := c.client.Disconnect(ctx)
+	c.client = nil
+	c.database = nil
+	c.collections = make(map[string]*mongo.Collection)
+	if err != nil {
+		return fmt.Errorf("could not disconnect from mongodb with error: %w", err)
+	}
+	return nil
+}
+
+// Client returns the underlying client or nil if the Connector is not connected
+func (c *Connector) Client() *mongo.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// Database returns the default database or nil if the Connector is not connected
+func (c *Connector) Database() *mongo.Database {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.database
+}
+
+// Collection returns the named collection(name) of the default database, the
+// collection is opened on first use and reused afterwards. It returns nil if
+// the Connector is not connected.
+func (c *Connector) Collection(name string) *mongo.Collection {
+	c.mu.RLock()
+	coll, ok := c.collections[name]
+	c.mu.RUnlock()
+	if ok {
+		return coll
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.database == nil {
+		return nil
+	}
+	if coll, ok := c.collections[name]; ok {
+		return coll
+	}
+	coll = c.database.Collection(name)
+	c.collections[name] = coll
+	return coll
+}
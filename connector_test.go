@@ -0,0 +1,64 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestConnector(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("not connected", func(t *testing.T) {
+		c := mc.NewConnector("testdb")
+		assert.Nil(t, c.Client())
+		assert.Nil(t, c.Database())
+		assert.Nil(t, c.Collection("users"))
+		assert.Nil(t, c.Close(ctx))
+	})
+
+	t.Run("independent connections", func(t *testing.T) {
+		// Connect does not block for server discovery so no server is needed
+		first := mc.NewConnector("first")
+		second := mc.NewConnector("second")
+		assert.Nil(t, first.Connect(ctx, "mongodb://localhost:27017"))
+		assert.Nil(t, second.Connect(ctx, "mongodb://localhost:27017"))
+
+		assert.Equal(t, "first", first.Database().Name())
+		assert.Equal(t, "second", second.Database().Name())
+		assert.Same(t, first.Collection("users"), first.Collection("users"))
+		assert.NotSame(t, first.Collection("users"), second.Collection("users"))
+
+		// a second Connect on the same connector is refused
+		assert.NotNil(t, first.Connect(ctx, "mongodb://localhost:27017"))
+
+		assert.Nil(t, first.Close(ctx))
+		assert.Nil(t, first.Collection("users"))
+		assert.NotNil(t, second.Collection("users"))
+		assert.Nil(t, second.Close(ctx))
+	})
+
+	t.Run("invalid uri", func(t *testing.T) {
+		c := mc.NewConnector("testdb")
+		assert.NotNil(t, c.Connect(ctx, "localhost:27017"))
+		assert.Nil(t, c.Client())
+	})
+}
+
+func TestConnectorConcerns(t *testing.T) {
+	ctx := context.Background()
+	rp := readpref.SecondaryPreferred()
+	c := mc.NewConnector("analytics", mc.WithReadPreference(rp), mc.WithReadConcern(readconcern.Available()))
+	assert.Nil(t, c.Connect(ctx, "mongodb://localhost:27017"))
+	defer c.Close(ctx)
+
+	assert.Equal(t, rp, c.Database().ReadPreference())
+	assert.Equal(t, readconcern.Available(), c.Database().ReadConcern())
+	// the client defaults apply where the connector sets nothing
+	assert.Nil(t, c.Database().WriteConcern())
+}
@@ -0,0 +1,127 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Sentinel errors the errors returned by the package can be tested against
+// with errors.Is
+var (
+	// ErrNotFound is reported when no record matches the filter
+	ErrNotFound = errors.New("mongoconnect: record not found")
+	// ErrDuplicateKey is reported when a write violates a unique index
+	ErrDuplicateKey = errors.New("mongoconnect: duplicate key")
+	// ErrTimeout is reported when the operation ran out of time
+	ErrTimeout = errors.New("mongoconnect: operation timed out")
+	// ErrNotConnected is reported when there is no usable connection to the
+	// server
+	ErrNotConnected = errors.New("mongoconnect: not connected")
+	// ErrInvalidFilter is reported when a filter is not a document
+	ErrInvalidFilter = errors.New("mongoconnect: invalid filter")
+	// ErrInvalidToken is reported when a page token can not be decoded
+	ErrInvalidToken = errors.New("mongoconnect: invalid page token")
+	// ErrNotAttempted is reported for the records of an ordered batch that
+	// follow its first failure and were not written
+	ErrNotAttempted = errors.New("mongoconnect: not attempted")
+)
+
+// Operation names reported in OpError.Op
+const (
+	OpCheckConnection      = "CheckConnection"
+	OpCreateEntry          = "CreateEntry"
+	OpCreateEntries        = "CreateEntries"
+	OpSingleItem           = "SingleItem"
+	OpAllItems             = "AllItems"
+	OpFindManyItems        = "FindManyItems"
+	OpRemoveOne            = "RemoveOne"
+	OpRemoveMany           = "RemoveMany"
+	OpUpdateOne            = "UpdateOne"
+	OpUpdateMany           = "UpdateMany"
+	OpReplaceOne           = "ReplaceOne"
+	OpUpsert               = "Upsert"
+	OpFindPage             = "FindPage"
+	OpForEach              = "ForEach"
+	OpAggregate            = "Aggregate"
+	OpCount                = "Count"
+	OpEstimatedCount       = "EstimatedCount"
+	OpExists               = "Exists"
+	OpDistinct             = "Distinct"
+	OpPlanIndexes          = "PlanIndexes"
+	OpEnsureIndexes        = "EnsureIndexes"
+	OpEnsureModel          = "EnsureModel"
+	OpTransaction          = "Transaction"
+	OpWatch                = "Watch"
+	OpBulkWrite            = "BulkWrite"
+	OpCreateEntriesBatched = "CreateEntriesBatched"
+	OpHealth               = "Health"
+)
+
+// OpError is the error returned by the helpers, it records the operation, the
+// collection and filter it ran with and the underlying cause. Use errors.Is
+// with the sentinel errors to classify it or errors.As to inspect it:
+// var opErr *OpError
+//
+//	if errors.As(err, &opErr) {
+//		log.Println(opErr.Op, opErr.Collection)
+//	}
+type OpError struct {
+	Op         string
+	Collection string
+	Filter     interface{}
+	Err        error
+}
+
+// opError wraps the cause(err) of a failed operation(op) on collection
+func opError(op string, collection *mongo.Collection, filter interface{}, err error) *OpError {
+	e := &OpError{Op: op, Filter: filter, Err: err}
+	if collection != nil {
+		e.Collection = collection.Name()
+	}
+	return e
+}
+
+// Error describes the failed operation and its cause
+func (e *OpError) Error() string {
+	msg := e.Op
+	if e.Collection != "" {
+		msg += " on " + e.Collection
+	}
+	if e.Filter != nil {
+		msg += fmt.Sprintf(" with filter %v", e.Filter)
+	}
+	return msg + " failed: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying cause
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the cause is classified as the sentinel error target
+func (e *OpError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return errors.Is(e.Err, mongo.ErrNoDocuments)
+	case ErrDuplicateKey:
+		return mongo.IsDuplicateKeyError(e.Err)
+	case ErrTimeout:
+		return mongo.IsTimeout(e.Err) || errors.Is(e.Err, context.DeadlineExceeded)
+	case ErrNotConnected:
+		var selectionErr topology.ServerSelectionError
+		return errors.Is(e.Err, mongo.ErrClientDisconnected) ||
+			errors.Is(e.Err, topology.ErrTopologyClosed) ||
+			errors.As(e.Err, &selectionErr)
+	}
+	return false
+}
+
+// hasErrorLabel reports whether the server labelled err with label
+func hasErrorLabel(err error, label string) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorLabel(label)
+}
@@ -0,0 +1,46 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestOpError(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key error"}}}
+	tests := []struct {
+		name string
+		err  error
+		is   error
+	}{
+		{"not found", mongo.ErrNoDocuments, mc.ErrNotFound},
+		{"duplicate key", duplicate, mc.ErrDuplicateKey},
+		{"timeout", context.DeadlineExceeded, mc.ErrTimeout},
+		{"wrapped timeout", fmt.Errorf("waiting: %w", context.DeadlineExceeded), mc.ErrTimeout},
+		{"disconnected", mongo.ErrClientDisconnected, mc.ErrNotConnected},
+	}
+	sentinels := []error{mc.ErrNotFound, mc.ErrDuplicateKey, mc.ErrTimeout, mc.ErrNotConnected}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := error(&mc.OpError{Op: mc.OpSingleItem, Collection: "users", Filter: bson.D{{"name", "john"}}, Err: tt.err})
+			for _, sentinel := range sentinels {
+				assert.Equal(t, sentinel == tt.is, errors.Is(err, sentinel), sentinel.Error())
+			}
+			// the cause stays reachable
+			assert.Equal(t, tt.err, errors.Unwrap(err))
+		})
+	}
+
+	t.Run("message", func(t *testing.T) {
+		err := &mc.OpError{Op: mc.OpRemoveOne, Collection: "users", Filter: bson.D{{"name", "john"}}, Err: mongo.ErrNoDocuments}
+		assert.Equal(t, "RemoveOne on users with filter [{name john}] failed: mongo: no documents in result", err.Error())
+	})
+}
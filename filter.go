@@ -0,0 +1,132 @@
+package mongoconnect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Filter builds a filter document one condition at a time, the empty Filter
+// matches every record:
+// filter := Filter{}.Eq("name", "john").Gt("age", 30).Lt("age", 40)
+// Conditions on the same field are combined into a single operator document.
+type Filter bson.D
+
+// Eq matches records where field equals value
+func (f Filter) Eq(field string, value interface{}) Filter {
+	for _, e := range f {
+		if e.Key == field {
+			return f.condition(field, "$eq", value)
+		}
+	}
+	return append(f[:len(f):len(f)], bson.E{Key: field, Value: value})
+}
+
+// Ne matches records where field does not equal value
+func (f Filter) Ne(field string, value interface{}) Filter {
+	return f.condition(field, "$ne", value)
+}
+
+// Gt matches records where field is greater than value
+func (f Filter) Gt(field string, value interface{}) Filter {
+	return f.condition(field, "$gt", value)
+}
+
+// Gte matches records where field is greater than or equal to value
+func (f Filter) Gte(field string, value interface{}) Filter {
+	return f.condition(field, "$gte", value)
+}
+
+// Lt matches records where field is less than value
+func (f Filter) Lt(field string, value interface{}) Filter {
+	return f.condition(field, "$lt", value)
+}
+
+// Lte matches records where field is less than or equal to value
+func (f Filter) Lte(field string, value interface{}) Filter {
+	return f.condition(field, "$lte", value)
+}
+
+// In matches records where field equals one of values
+func (f Filter) In(field string, values ...interface{}) Filter {
+	return f.condition(field, "$in", bson.A(values))
+}
+
+// Nin matches records where field equals none of values
+func (f Filter) Nin(field string, values ...interface{}) Filter {
+	return f.condition(field, "$nin", bson.A(values))
+}
+
+// Exists matches records that have field when exists is true, or lack it when
+// exists is false
+func (f Filter) Exists(field string, exists bool) Filter {
+	return f.condition(field, "$exists", exists)
+}
+
+// Or matches records matching any of filters
+func (f Filter) Or(filters ...Filter) Filter {
+	clauses := make(bson.A, len(filters))
+	for i, filter := range filters {
+		clauses[i] = bson.D(filter)
+	}
+	return append(f[:len(f):len(f)], bson.E{Key: "$or", Value: clauses})
+}
+
+// condition adds the operator(op) with value to the conditions on field, the
+// Filter is copied so earlier Filters are never changed
+func (f Filter) condition(field string, op string, value interface{}) Filter {
+	out := make(Filter, len(f), len(f)+1)
+	copy(out, f)
+	for i, e := range out {
+		if e.Key != field {
+			continue
+		}
+		operators, ok := e.Value.(bson.D)
+		if !ok || len(operators) == 0 || !strings.HasPrefix(operators[0].Key, "$") {
+			// turn a plain equality into an operator document
+			operators = bson.D{{Key: "$eq", Value: e.Value}}
+		}
+		out[i].Value = append(operators[:len(operators):len(operators)], bson.E{Key: op, Value: value})
+		return out
+	}
+	return append(out, bson.E{Key: field, Value: bson.D{{Key: op, Value: value}}})
+}
+
+// normalizeFilter returns filter in a form the driver accepts, a nil filter
+// matches every record. Filters that are not documents, such as bson.A or a
+// string, are reported as ErrInvalidFilter instead of failing in the driver.
+func normalizeFilter(filter interface{}) (interface{}, error) {
+	switch f := filter.(type) {
+	case nil:
+		return bson.D{}, nil
+	case bson.D, bson.M:
+		return f, nil
+	case Filter:
+		return bson.D(f), nil
+	case *Query:
+		if f == nil {
+			return nil, fmt.Errorf("%w: nil %T", ErrInvalidFilter, filter)
+		}
+		return f.Filter(), nil
+	case bson.Raw:
+		if err := f.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+		return f, nil
+	}
+
+	v := reflect.ValueOf(filter)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, fmt.Errorf("%w: nil %T", ErrInvalidFilter, filter)
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct && v.Kind() != reflect.Map {
+		return nil, fmt.Errorf("%w: %T is not a document", ErrInvalidFilter, filter)
+	}
+	// the driver encodes it with the registry of the collection
+	return filter, nil
+}
@@ -0,0 +1,77 @@
+package mongoconnect_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestFilter(t *testing.T) {
+	base := mc.Filter{}.Eq("name", "john")
+	filter := base.Gt("age", 30).Lt("age", 40).In("role", "admin", "owner")
+
+	assert.Equal(t, mc.Filter{
+		{"name", "john"},
+		{"age", bson.D{{"$gt", 30}, {"$lt", 40}}},
+		{"role", bson.D{{"$in", bson.A{"admin", "owner"}}}},
+	}, filter)
+	// building on a filter leaves it unchanged
+	assert.Equal(t, mc.Filter{{"name", "john"}}, base)
+
+	assert.Equal(t, mc.Filter{
+		{"name", bson.D{{"$eq", "john"}, {"$ne", "jane"}}},
+	}, base.Ne("name", "jane"))
+
+	assert.Equal(t, mc.Filter{
+		{"$or", bson.A{
+			bson.D{{"name", "john"}},
+			bson.D{{"email", bson.D{{"$exists", false}}}},
+		}},
+	}, mc.Filter{}.Or(base, mc.Filter{}.Exists("email", false)))
+}
+
+func TestRemoveManyFilterTypes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	raw, err := bson.Marshal(bson.D{{"name", "john"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := map[string]interface{}{
+		"bson.D":  bson.D{{"name", "john"}},
+		"bson.M":  bson.M{"name": "john"},
+		"struct":  struct{ Name string }{"john"},
+		"pointer": &mc.User{Name: "john"},
+		"raw":     bson.Raw(raw),
+		"filter":  mc.Filter{}.Eq("name", "john"),
+	}
+	for name, filter := range valid {
+		filter := filter
+		mt.Run(name, func(mt *mtest.T) {
+			mt.AddMockResponses(bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 1}})
+			res, err := mc.RemoveMany(mt.Coll, filter)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(1), res.DeletedCount)
+		})
+	}
+
+	invalid := map[string]interface{}{
+		"array":       bson.A{"john"},
+		"string":      "john",
+		"nil pointer": (*mc.User)(nil),
+		"bad raw":     bson.Raw{0x01},
+	}
+	for name, filter := range invalid {
+		filter := filter
+		mt.Run(name, func(mt *mtest.T) {
+			res, err := mc.RemoveMany(mt.Coll, filter)
+			assert.Nil(t, res)
+			assert.ErrorIs(t, err, mc.ErrInvalidFilter)
+		})
+	}
+}
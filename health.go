@@ -0,0 +1,261 @@
+package mongoconnect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Statuses of a HealthReport
+const (
+	// HealthUp is a deployment that takes reads and writes
+	HealthUp = "up"
+	// HealthDegraded is a reachable deployment without a primary, or a
+	// replica set without a secondary to fail over to
+	HealthDegraded = "degraded"
+	// HealthDown is a deployment that can not be reached
+	HealthDown = "down"
+)
+
+// Topology types of a HealthReport
+const (
+	TopologySingle     = "Single"
+	TopologyReplicaSet = "ReplicaSet"
+	TopologySharded    = "Sharded"
+)
+
+// HealthReport describes the state of a deployment as seen by Health
+type HealthReport struct {
+	// Status is HealthUp, HealthDegraded or HealthDown
+	Status string
+	// Latency is the round trip of a ping to the nearest server
+	Latency time.Duration
+	// Topology is TopologySingle, TopologyReplicaSet or TopologySharded
+	Topology string
+	// ReplicaSet is the name of the replica set
+	ReplicaSet string
+	// Primary tells if a server takes writes
+	Primary bool
+	// Secondaries is the number of healthy secondaries of a replica set
+	Secondaries int
+	// Version is the server version
+	Version string
+	// ReplicationLag is how far the slowest healthy secondary is behind the
+	// primary. It needs replSetGetStatus, which the clusterMonitor role
+	// grants, without it Secondaries and ReplicationLag stay zero.
+	ReplicationLag time.Duration
+	// Err is why the deployment is down or the report is incomplete
+	Err error
+	// CheckedAt is when the report was taken
+	CheckedAt time.Time
+}
+
+// Ready reports whether the deployment takes reads and writes
+func (h *HealthReport) Ready() bool {
+	return h.Status != HealthDown && h.Primary
+}
+
+// MarshalJSON writes the report with the durations as text such as "1.5ms"
+// and the error as its message
+func (h *HealthReport) MarshalJSON() ([]byte, error) {
+	report := struct {
+		Status         string    `json:"status"`
+		Latency        string    `json:"latency,omitempty"`
+		Topology       string    `json:"topology,omitempty"`
+		ReplicaSet     string    `json:"replicaSet,omitempty"`
+		Primary        bool      `json:"primary"`
+		Secondaries    int       `json:"secondaries"`
+		Version        string    `json:"version,omitempty"`
+		ReplicationLag string    `json:"replicationLag,omitempty"`
+		Error          string    `json:"error,omitempty"`
+		CheckedAt      time.Time `json:"checkedAt"`
+	}{
+		Status:      h.Status,
+		Topology:    h.Topology,
+		ReplicaSet:  h.ReplicaSet,
+		Primary:     h.Primary,
+		Secondaries: h.Secondaries,
+		Version:     h.Version,
+		CheckedAt:   h.CheckedAt,
+	}
+	if h.Latency > 0 {
+		report.Latency = h.Latency.String()
+	}
+	if h.Topology == TopologyReplicaSet {
+		report.ReplicationLag = h.ReplicationLag.String()
+	}
+	if h.Err != nil {
+		report.Error = h.Err.Error()
+	}
+	return json.Marshal(report)
+}
+
+// Health returns the health of the deployment of the Connector, see Health
+func (c *Connector) Health(ctx context.Context, opts ...Option) *HealthReport {
+	return Health(ctx, c.Client(), opts...)
+}
+
+// Health reports the state of the deployment client is connected to, unlike
+// CheckConnection it tells why a deployment is unhealthy:
+// report := Health(ctx, client)
+// log.Println(report.Status, report.Latency, report.Err)
+// The checks are bounded together by the timeout of OpHealth.
+func Health(ctx context.Context, client *mongo.Client, opts ...Option) *HealthReport {
+	report := &HealthReport{Status: HealthDown, CheckedAt: time.Now()}
+	if client == nil {
+		report.Err = ErrNotConnected
+		return report
+	}
+	ctx, cancel := resolve(opts).withTimeout(ctx, OpHealth)
+	defer cancel()
+
+	start := time.Now()
+	if err := client.Ping(ctx, readpref.Nearest()); err != nil {
+		report.Err = opError(OpHealth, nil, nil, err)
+		logger().Warn("mongo deployment is down", "op", OpHealth, "error", err)
+		return report
+	}
+	report.Latency = time.Since(start)
+
+	if err := report.describe(ctx, client.Database("admin")); err != nil {
+		report.Err = opError(OpHealth, nil, nil, err)
+	}
+	report.Status = HealthUp
+	if !report.Primary || (report.Topology == TopologyReplicaSet && report.Secondaries == 0 && report.Err == nil) {
+		report.Status = HealthDegraded
+	}
+	logger().Debug("mongo health", "op", OpHealth, "status", report.Status, "duration", time.Since(start))
+	return report
+}
+
+// helloResult holds the fields of the hello command the report uses
+type helloResult struct {
+	SetName           string `bson:"setName"`
+	Primary           string `bson:"primary"`
+	IsWritablePrimary bool   `bson:"isWritablePrimary"`
+	IsMaster          bool   `bson:"ismaster"`
+	Msg               string `bson:"msg"`
+}
+
+// replSetStatus holds the fields of the replSetGetStatus command the report
+// uses
+type replSetStatus struct {
+	Members []struct {
+		State      int       `bson:"state"`
+		Health     float64   `bson:"health"`
+		OptimeDate time.Time `bson:"optimeDate"`
+	} `bson:"members"`
+}
+
+// Replica set member states
+const (
+	statePrimary   = 1
+	stateSecondary = 2
+)
+
+// describe fills in the topology, version and replication state of the
+// deployment from the commands run on admin
+func (h *HealthReport) describe(ctx context.Context, admin *mongo.Database) error {
+	// any member answers, so a replica set without a primary is described too
+	nearest := options.RunCmd().SetReadPreference(readpref.Nearest())
+
+	var hello helloResult
+	err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}, nearest).Decode(&hello)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 59 {
+		// servers before 4.4.2 only know the legacy name, code 59 is
+		// CommandNotFound
+		err = admin.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}, nearest).Decode(&hello)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read topology: %w", err)
+	}
+	switch {
+	case hello.Msg == "isdbgrid":
+		// mongos routes the writes to the primaries of the shards
+		h.Topology, h.Primary = TopologySharded, true
+	case hello.SetName != "":
+		h.Topology, h.ReplicaSet = TopologyReplicaSet, hello.SetName
+		h.Primary = hello.Primary != "" || hello.IsWritablePrimary || hello.IsMaster
+	default:
+		h.Topology, h.Primary = TopologySingle, true
+	}
+
+	var build struct {
+		Version string `bson:"version"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}, nearest).Decode(&build); err != nil {
+		return fmt.Errorf("could not read server version: %w", err)
+	}
+	h.Version = build.Version
+
+	if h.Topology != TopologyReplicaSet {
+		return nil
+	}
+	var status replSetStatus
+	if err := admin.RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}, nearest).Decode(&status); err != nil {
+		return fmt.Errorf("could not read replica set status: %w", err)
+	}
+	var primary, slowest time.Time
+	for _, member := range status.Members {
+		if member.Health != 1 {
+			continue
+		}
+		switch member.State {
+		case statePrimary:
+			primary = member.OptimeDate
+		case stateSecondary:
+			h.Secondaries++
+			if slowest.IsZero() || member.OptimeDate.Before(slowest) {
+				slowest = member.OptimeDate
+			}
+		}
+	}
+	if !primary.IsZero() && !slowest.IsZero() && primary.After(slowest) {
+		h.ReplicationLag = primary.Sub(slowest)
+	}
+	return nil
+}
+
+// HealthHandler returns an http.Handler for Kubernetes probes serving
+// /livez, which answers 200 while the Connector is connected, and /readyz,
+// which answers 200 while Health reports the deployment Ready and 503
+// otherwise. Both answer with a JSON body, /readyz with the HealthReport:
+// http.Handle("/health/", http.StripPrefix("/health", connector.HealthHandler()))
+func (c *Connector) HealthHandler(opts ...Option) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		if c.Client() == nil {
+			writeHealth(w, http.StatusServiceUnavailable, map[string]string{"status": HealthDown, "error": ErrNotConnected.Error()})
+			return
+		}
+		writeHealth(w, http.StatusOK, map[string]string{"status": HealthUp})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := c.Health(r.Context(), opts...)
+		code := http.StatusOK
+		if !report.Ready() {
+			code = http.StatusServiceUnavailable
+		}
+		writeHealth(w, code, report)
+	})
+	return mux
+}
+
+// writeHealth writes body as the JSON answer of a probe
+func writeHealth(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger().Warn("could not write health", "op", OpHealth, "error", err)
+	}
+}
@@ -0,0 +1,139 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestHealth(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	mt.Run("single", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "isWritablePrimary", Value: true}),
+			mtest.CreateSuccessResponse(bson.E{Key: "version", Value: "6.0.3"}),
+		)
+		report := mc.Health(ctx, mt.Client)
+		assert.Nil(t, report.Err)
+		assert.Equal(t, mc.HealthUp, report.Status)
+		assert.Equal(t, mc.TopologySingle, report.Topology)
+		assert.Equal(t, "6.0.3", report.Version)
+		assert.True(t, report.Primary)
+		assert.True(t, report.Ready())
+	})
+
+	mt.Run("replica set", func(mt *mtest.T) {
+		now := time.Now().Truncate(time.Millisecond)
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(
+				bson.E{Key: "setName", Value: "rs0"},
+				bson.E{Key: "primary", Value: "db1:27017"},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "version", Value: "5.0.9"}),
+			mtest.CreateSuccessResponse(bson.E{Key: "members", Value: bson.A{
+				bson.D{{"state", 1}, {"health", 1.0}, {"optimeDate", now}},
+				bson.D{{"state", 2}, {"health", 1.0}, {"optimeDate", now.Add(-3 * time.Second)}},
+				bson.D{{"state", 2}, {"health", 1.0}, {"optimeDate", now.Add(-time.Second)}},
+				// an unreachable member does not count
+				bson.D{{"state", 8}, {"health", 0.0}, {"optimeDate", now.Add(-time.Hour)}},
+			}}),
+		)
+		report := mc.Health(ctx, mt.Client)
+		assert.Nil(t, report.Err)
+		assert.Equal(t, mc.HealthUp, report.Status)
+		assert.Equal(t, mc.TopologyReplicaSet, report.Topology)
+		assert.Equal(t, "rs0", report.ReplicaSet)
+		assert.Equal(t, 2, report.Secondaries)
+		assert.Equal(t, 3*time.Second, report.ReplicationLag)
+		assert.True(t, report.Ready())
+	})
+
+	mt.Run("no primary", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "setName", Value: "rs0"}, bson.E{Key: "secondary", Value: true}),
+			mtest.CreateSuccessResponse(bson.E{Key: "version", Value: "5.0.9"}),
+			mtest.CreateSuccessResponse(bson.E{Key: "members", Value: bson.A{
+				bson.D{{"state", 2}, {"health", 1.0}, {"optimeDate", time.Now()}},
+			}}),
+		)
+		report := mc.Health(ctx, mt.Client)
+		assert.Equal(t, mc.HealthDegraded, report.Status)
+		assert.False(t, report.Primary)
+		assert.False(t, report.Ready())
+	})
+
+	mt.Run("down", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Name: "Unauthorized", Message: "not authorized"}))
+		report := mc.Health(ctx, mt.Client)
+		assert.Equal(t, mc.HealthDown, report.Status)
+		assert.NotNil(t, report.Err)
+		assert.False(t, report.Ready())
+
+		body, err := json.Marshal(report)
+		assert.Nil(t, err)
+		var decoded map[string]interface{}
+		assert.Nil(t, json.Unmarshal(body, &decoded))
+		assert.Equal(t, "down", decoded["status"])
+		assert.Contains(t, decoded["error"], "not authorized")
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		report := mc.Health(ctx, nil)
+		assert.Equal(t, mc.HealthDown, report.Status)
+		assert.True(t, errors.Is(report.Err, mc.ErrNotConnected))
+	})
+}
+
+func TestHealthHandler(t *testing.T) {
+	ctx := context.Background()
+	get := func(h http.Handler, path string) (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var body map[string]interface{}
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	t.Run("not connected", func(t *testing.T) {
+		h := mc.NewConnector("testdb").HealthHandler()
+		code, body := get(h, "/livez")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "down", body["status"])
+		code, body = get(h, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "down", body["status"])
+	})
+
+	t.Run("unreachable server", func(t *testing.T) {
+		// Connect does not block for server discovery so no server is needed
+		c := mc.NewConnector("testdb")
+		assert.Nil(t, c.Connect(ctx, "mongodb://localhost:1"))
+		defer c.Close(ctx)
+		h := c.HealthHandler(mc.WithOperationTimeout(mc.OpHealth, 100*time.Millisecond))
+
+		code, body := get(h, "/livez")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "up", body["status"])
+		code, body = get(h, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "down", body["status"])
+		assert.NotEmpty(t, body["error"])
+	})
+}
@@ -0,0 +1,454 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec describes an index of a collection, the indexes of a collection
+// are declared as a list of them:
+// indexes := []IndexSpec{
+// {Keys: IndexKeys("email"), Unique: true},
+// {Keys: IndexKeys("-created", "name")},
+// {Keys: IndexKeys("created"), ExpireAfter: 24 * time.Hour},
+// {Keys: IndexKeys("name"), PartialFilter: Filter{}.Eq("active", true)},
+// {Keys: TextIndexKeys("name", "bio")},
+// }
+// plan, err := EnsureIndexes(ctx, collection, indexes)
+type IndexSpec struct {
+	// Name of the index, derived from the keys the way the server does when
+	// empty
+	Name string
+	// Keys are the indexed fields in order with their direction or index type
+	Keys bson.D
+	// Unique rejects records with a key that is already in the index
+	Unique bool
+	// ExpireAfter removes records this long after the time in their single
+	// indexed field, zero keeps them
+	ExpireAfter time.Duration
+	// PartialFilter indexes only the records matching it, it is anything the
+	// find helpers accept
+	PartialFilter interface{}
+}
+
+// IndexKeys returns the keys of an index on fields, a field prefixed with "-"
+// is indexed descending
+func IndexKeys(fields ...string) bson.D {
+	return fieldSpec(fields, -1)
+}
+
+// TextIndexKeys returns the keys of a text index on fields
+func TextIndexKeys(fields ...string) bson.D {
+	keys := make(bson.D, len(fields))
+	for i, field := range fields {
+		keys[i] = bson.E{Key: field, Value: "text"}
+	}
+	return keys
+}
+
+// IndexPlan lists the changes that bring the indexes of a collection in line
+// with their specs
+type IndexPlan struct {
+	// Drop holds the names of the indexes missing from the specs, they are
+	// only listed and dropped with WithPruneIndexes
+	Drop []string
+	// Replace holds the indexes that differ from their specs, also in their
+	// name, each is dropped and created again
+	Replace []IndexSpec
+	// Create holds the indexes to create
+	Create []IndexSpec
+
+	// previous holds the replaced indexes as listIndexes reports them by name
+	previous map[string]bson.Raw
+}
+
+// Empty reports whether the indexes already match their specs
+func (p *IndexPlan) Empty() bool {
+	return len(p.Drop) == 0 && len(p.Replace) == 0 && len(p.Create) == 0
+}
+
+// String lists the changes of the plan, one per line
+func (p *IndexPlan) String() string {
+	var b strings.Builder
+	for _, name := range p.Drop {
+		fmt.Fprintf(&b, "drop %s\n", name)
+	}
+	for _, spec := range p.Replace {
+		if name := indexName(p.previous[spec.name()]); name != spec.name() {
+			fmt.Fprintf(&b, "replace %s with %s\n", name, spec)
+			continue
+		}
+		fmt.Fprintf(&b, "replace %s\n", spec)
+	}
+	for _, spec := range p.Create {
+		fmt.Fprintf(&b, "create %s\n", spec)
+	}
+	return b.String()
+}
+
+// changes returns the number of changes in the plan
+func (p *IndexPlan) changes() int64 {
+	return int64(len(p.Drop) + len(p.Replace) + len(p.Create))
+}
+
+// String describes the index by its name, keys and options
+func (s IndexSpec) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %v", s.name(), s.Keys)
+	if s.Unique {
+		b.WriteString(" unique")
+	}
+	if s.ExpireAfter > 0 {
+		fmt.Fprintf(&b, " expire after %v", s.ExpireAfter)
+	}
+	if s.PartialFilter != nil {
+		fmt.Fprintf(&b, " partial %v", s.PartialFilter)
+	}
+	return b.String()
+}
+
+// PlanIndexes compares the indexes of Collection(collection) with specs and
+// returns the changes EnsureIndexes would make without making them. Indexes
+// missing from specs are kept unless WithPruneIndexes is given, the _id index
+// is always kept.
+func PlanIndexes(ctx context.Context, collection *mongo.Collection, specs []IndexSpec, opts ...Option) (*IndexPlan, error) {
+	cfg := resolve(opts)
+	var plan *IndexPlan
+	err := run(ctx, cfg, OpPlanIndexes, collection, nil, func(ctx context.Context, collection *mongo.Collection, _ interface{}) (int64, error) {
+		var err error
+		plan, err = planIndexes(ctx, collection, specs, cfg.PruneIndexes)
+		if err != nil {
+			return 0, err
+		}
+		return plan.changes(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// EnsureIndexes brings the indexes of Collection(collection) in line with
+// specs and returns the changes it made, see PlanIndexes. The new indexes are
+// created first, then the changed ones are replaced one at a time and the
+// pruned ones dropped last. A changed index that can not be created, for
+// example a unique index over duplicates, is restored as it was.
+func EnsureIndexes(ctx context.Context, collection *mongo.Collection, specs []IndexSpec, opts ...Option) (*IndexPlan, error) {
+	cfg := resolve(opts)
+	var plan *IndexPlan
+	err := run(ctx, cfg, OpEnsureIndexes, collection, nil, func(ctx context.Context, collection *mongo.Collection, _ interface{}) (int64, error) {
+		var err error
+		plan, err = planIndexes(ctx, collection, specs, cfg.PruneIndexes)
+		if err != nil {
+			return 0, err
+		}
+		if err := createIndexes(ctx, collection, plan.Create...); err != nil {
+			return 0, err
+		}
+		for _, spec := range plan.Replace {
+			if err := replaceIndex(ctx, collection, spec, plan.previous[spec.name()]); err != nil {
+				return 0, err
+			}
+		}
+		for _, name := range plan.Drop {
+			if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+				return 0, fmt.Errorf("could not drop index %s: %w", name, err)
+			}
+		}
+		return plan.changes(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// createIndexes creates the indexes of specs on collection
+func createIndexes(ctx context.Context, collection *mongo.Collection, specs ...IndexSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	models := make([]mongo.IndexModel, len(specs))
+	for i, spec := range specs {
+		var err error
+		if models[i], err = spec.model(); err != nil {
+			return err
+		}
+	}
+	if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+		return fmt.Errorf("could not create indexes: %w", err)
+	}
+	return nil
+}
+
+// replaceIndex drops the index(previous) spec replaces and creates spec in its
+// place, the dropped index is created again when spec can not be
+func replaceIndex(ctx context.Context, collection *mongo.Collection, spec IndexSpec, previous bson.Raw) error {
+	// the server refuses a second index on the same keys or under the same
+	// name, so the old index goes first
+	name := indexName(previous)
+	if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+		return fmt.Errorf("could not drop index %s: %w", name, err)
+	}
+	err := createIndexes(ctx, collection, spec)
+	if err == nil {
+		return nil
+	}
+	restore := bson.D{}
+	elements, _ := previous.Elements()
+	for _, element := range elements {
+		// ns is reported by servers before 4.4 but not accepted back
+		if element.Key() != "ns" {
+			restore = append(restore, bson.E{Key: element.Key(), Value: element.Value()})
+		}
+	}
+	restoreErr := collection.Database().RunCommand(ctx, bson.D{
+		{Key: "createIndexes", Value: collection.Name()},
+		{Key: "indexes", Value: bson.A{restore}},
+	}).Err()
+	if restoreErr != nil {
+		return fmt.Errorf("index %s was dropped and could not be restored (%v): %w", spec.name(), restoreErr, err)
+	}
+	logger().Warn("restored index", "op", OpEnsureIndexes, "index", spec.name(), "error", err)
+	return err
+}
+
+// indexName returns the name of an index as listIndexes reports it(index)
+func indexName(index bson.Raw) string {
+	name, _ := index.Lookup("name").StringValueOK()
+	return name
+}
+
+// indexInfo is an index as listIndexes reports it
+type indexInfo struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	ExpireAfterSeconds      *int64 `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.D `bson:"partialFilterExpression"`
+	Weights                 bson.D `bson:"weights"`
+}
+
+// planIndexes lists the indexes of collection and compares them with specs,
+// an index is found by its name or else by its keys. The indexes missing from
+// specs are dropped when prune is set.
+func planIndexes(ctx context.Context, collection *mongo.Collection, specs []IndexSpec, prune bool) (*IndexPlan, error) {
+	wanted := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		if len(spec.Keys) == 0 {
+			return nil, errors.New("index without keys")
+		}
+		if wanted[spec.name()] {
+			return nil, fmt.Errorf("index %s declared twice", spec.name())
+		}
+		wanted[spec.name()] = true
+	}
+
+	cur, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list indexes: %w", err)
+	}
+	defer cur.Close(ctx)
+	var (
+		existing []indexInfo
+		raws     []bson.Raw
+	)
+	_, err = decodeEach(ctx, cur, func(raw bson.Raw) error {
+		var index indexInfo
+		if err := bson.Unmarshal(raw, &index); err != nil {
+			return fmt.Errorf("could not decode index: %w", err)
+		}
+		existing, raws = append(existing, index), append(raws, raw)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &IndexPlan{previous: make(map[string]bson.Raw)}
+	// claimed holds the existing indexes that belong to a spec
+	claimed := map[string]bool{"_id_": true}
+	for _, spec := range specs {
+		i := findIndex(existing, claimed, func(index indexInfo) bool { return index.Name == spec.name() })
+		if i < 0 {
+			// an index on the same keys under another name, the server
+			// refuses a second one
+			keys, _ := spec.storedKeys()
+			i = findIndex(existing, claimed, func(index indexInfo) bool { return sameDocument(keys, index.Key) })
+		}
+		if i < 0 {
+			plan.Create = append(plan.Create, spec)
+			continue
+		}
+		claimed[existing[i].Name] = true
+		same, err := spec.matches(existing[i])
+		if err != nil {
+			return nil, err
+		}
+		if !same || existing[i].Name != spec.name() {
+			plan.Replace = append(plan.Replace, spec)
+			plan.previous[spec.name()] = raws[i]
+		}
+	}
+	if prune {
+		for _, index := range existing {
+			if !claimed[index.Name] {
+				plan.Drop = append(plan.Drop, index.Name)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// findIndex returns the position of the first index in indexes that is not
+// claimed and matches, -1 when there is none
+func findIndex(indexes []indexInfo, claimed map[string]bool, match func(index indexInfo) bool) int {
+	for i, index := range indexes {
+		if !claimed[index.Name] && match(index) {
+			return i
+		}
+	}
+	return -1
+}
+
+// name returns the name of the index, derived from the keys when not set
+func (s IndexSpec) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	parts := make([]string, len(s.Keys))
+	for i, key := range s.Keys {
+		parts[i] = fmt.Sprintf("%s_%v", key.Key, key.Value)
+	}
+	return strings.Join(parts, "_")
+}
+
+// model returns the index model creating the index
+func (s IndexSpec) model() (mongo.IndexModel, error) {
+	opts := options.Index().SetName(s.name())
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(s.ExpireAfter / time.Second))
+	}
+	if s.PartialFilter != nil {
+		filter, err := normalizeFilter(s.PartialFilter)
+		if err != nil {
+			return mongo.IndexModel{}, fmt.Errorf("index %s: %w", s.name(), err)
+		}
+		opts.SetPartialFilterExpression(filter)
+	}
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}, nil
+}
+
+// matches reports whether the existing index is the one the spec describes
+func (s IndexSpec) matches(index indexInfo) (bool, error) {
+	if s.Unique != index.Unique {
+		return false, nil
+	}
+	var expire int64
+	if index.ExpireAfterSeconds != nil {
+		expire = *index.ExpireAfterSeconds
+	}
+	if int64(s.ExpireAfter/time.Second) != expire {
+		return false, nil
+	}
+
+	var partial bson.D
+	if s.PartialFilter != nil {
+		model, err := s.model()
+		if err != nil {
+			return false, err
+		}
+		raw, err := bson.Marshal(model.Options.PartialFilterExpression)
+		if err != nil {
+			return false, err
+		}
+		if err := bson.Unmarshal(raw, &partial); err != nil {
+			return false, err
+		}
+	}
+	if !sameDocument(partial, index.PartialFilterExpression) {
+		return false, nil
+	}
+
+	keys, textFields := s.storedKeys()
+	if !sameDocument(keys, index.Key) {
+		return false, nil
+	}
+	weighted := make([]string, len(index.Weights))
+	for i, weight := range index.Weights {
+		weighted[i] = weight.Key
+	}
+	sort.Strings(textFields)
+	sort.Strings(weighted)
+	return strings.Join(textFields, ",") == strings.Join(weighted, ","), nil
+}
+
+// storedKeys returns the keys of the index the way the server stores them and
+// the fields of its text index. The server stores the fields of a text index
+// as weights behind the _fts and _ftsx keys.
+func (s IndexSpec) storedKeys() (bson.D, []string) {
+	var keys bson.D
+	var textFields []string
+	for _, key := range s.Keys {
+		if key.Value != "text" {
+			keys = append(keys, key)
+			continue
+		}
+		if textFields == nil {
+			keys = append(keys, bson.E{Key: "_fts", Value: "text"}, bson.E{Key: "_ftsx", Value: 1})
+		}
+		textFields = append(textFields, key.Key)
+	}
+	return keys, textFields
+}
+
+// sameDocument compares two documents field by field in order, numbers
+// compare by value whatever their type
+func sameDocument(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || !sameValue(a[i].Value, b[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameValue compares two document values, see sameDocument
+func sameValue(a, b interface{}) bool {
+	switch x := a.(type) {
+	case bson.D:
+		y, ok := b.(bson.D)
+		return ok && sameDocument(x, y)
+	case bson.A:
+		y, ok := b.(bson.A)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !sameValue(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
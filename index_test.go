@@ -0,0 +1,134 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestEnsureIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	specs := []mc.IndexSpec{
+		{Keys: mc.IndexKeys("email"), Unique: true},
+		{Keys: mc.IndexKeys("created"), ExpireAfter: time.Hour},
+		{Keys: mc.IndexKeys("-age", "name"), PartialFilter: mc.Filter{}.Gt("age", 18)},
+		{Keys: mc.TextIndexKeys("name", "bio")},
+	}
+	existing := []bson.D{
+		{{"v", 2}, {"key", bson.D{{"_id", 1}}}, {"name", "_id_"}},
+		// not unique, must be recreated
+		{{"v", 2}, {"key", bson.D{{"email", 1}}}, {"name", "email_1"}},
+		{{"v", 2}, {"key", bson.D{{"created", 1}}}, {"name", "created_1"}, {"expireAfterSeconds", int32(3600)}},
+		{{"v", 2}, {"key", bson.D{{"age", -1}, {"name", 1}}}, {"name", "age_-1_name_1"}, {"partialFilterExpression", bson.D{{"age", bson.D{{"$gt", int32(18)}}}}}},
+		{{"v", 2}, {"key", bson.D{{"_fts", "text"}, {"_ftsx", 1}}}, {"name", "name_text_bio_text"}, {"weights", bson.D{{"bio", 1}, {"name", 1}}}},
+		// not declared
+		{{"v", 2}, {"key", bson.D{{"old", 1}}}, {"name", "old_1"}},
+	}
+
+	mt.Run("plan", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, existing...))
+		plan, err := mc.PlanIndexes(ctx, mt.Coll, specs)
+		assert.Nil(t, err)
+		// undeclared indexes are kept by default
+		assert.Empty(t, plan.Drop)
+		assert.Equal(t, []mc.IndexSpec{specs[0]}, plan.Replace)
+		assert.Empty(t, plan.Create)
+		assert.Equal(t, "replace email_1 [{email 1}] unique\n", plan.String())
+		// a dry run only lists the indexes
+		assert.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+		assert.Nil(t, mt.GetStartedEvent())
+	})
+
+	mt.Run("plan pruned", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, existing...))
+		plan, err := mc.PlanIndexes(ctx, mt.Coll, specs[1:], mc.WithPruneIndexes())
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"email_1", "old_1"}, plan.Drop)
+		assert.Empty(t, plan.Replace)
+		assert.Equal(t, "drop email_1\ndrop old_1\n", plan.String())
+	})
+
+	mt.Run("ensure", func(mt *mtest.T) {
+		spec := mc.IndexSpec{Keys: mc.IndexKeys("country")}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, existing...),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		plan, err := mc.EnsureIndexes(ctx, mt.Coll, append([]mc.IndexSpec{spec}, specs...), mc.WithPruneIndexes())
+		assert.Nil(t, err)
+		assert.False(t, plan.Empty())
+
+		assert.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+		// new indexes first, then the replaced ones, the pruned ones last
+		assert.Equal(t, "country_1", mt.GetStartedEvent().Command.Lookup("indexes", "0", "name").StringValue())
+		assert.Equal(t, "email_1", mt.GetStartedEvent().Command.Lookup("index").StringValue())
+		created := mt.GetStartedEvent().Command
+		assert.Equal(t, "email_1", created.Lookup("indexes", "0", "name").StringValue())
+		assert.True(t, created.Lookup("indexes", "0", "unique").Boolean())
+		assert.Equal(t, "old_1", mt.GetStartedEvent().Command.Lookup("index").StringValue())
+	})
+
+	mt.Run("restore on failure", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, existing...),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Name: "DuplicateKey", Message: "duplicate key"}),
+			mtest.CreateSuccessResponse(),
+		)
+		_, err := mc.EnsureIndexes(ctx, mt.Coll, specs)
+		assert.ErrorIs(t, err, mc.ErrDuplicateKey)
+
+		assert.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+		assert.Equal(t, "dropIndexes", mt.GetStartedEvent().CommandName)
+		assert.Equal(t, "createIndexes", mt.GetStartedEvent().CommandName)
+		restored := mt.GetStartedEvent().Command
+		assert.Equal(t, "email_1", restored.Lookup("indexes", "0", "name").StringValue())
+		_, err = restored.LookupErr("indexes", "0", "unique")
+		assert.NotNil(t, err, "the old index was not unique")
+	})
+
+	mt.Run("other name", func(mt *mtest.T) {
+		// created by hand on the keys of the spec
+		renamed := bson.D{{"v", 2}, {"key", bson.D{{"email", 1}}}, {"name", "email_unique"}, {"unique", true}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, existing[0], renamed),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		plan, err := mc.EnsureIndexes(ctx, mt.Coll, specs[:1], mc.WithPruneIndexes())
+		assert.Nil(t, err)
+		assert.Empty(t, plan.Create)
+		assert.Empty(t, plan.Drop)
+		assert.Equal(t, "replace email_unique with email_1 [{email 1}] unique\n", plan.String())
+
+		assert.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+		assert.Equal(t, "email_unique", mt.GetStartedEvent().Command.Lookup("index").StringValue())
+		assert.Equal(t, "email_1", mt.GetStartedEvent().Command.Lookup("indexes", "0", "name").StringValue())
+	})
+
+	mt.Run("up to date", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, existing[0], existing[2]))
+		plan, err := mc.EnsureIndexes(ctx, mt.Coll, []mc.IndexSpec{specs[1]})
+		assert.Nil(t, err)
+		assert.True(t, plan.Empty())
+	})
+
+	mt.Run("invalid spec", func(mt *mtest.T) {
+		_, err := mc.PlanIndexes(ctx, mt.Coll, []mc.IndexSpec{{Name: "empty"}})
+		assert.NotNil(t, err)
+		_, err = mc.PlanIndexes(ctx, mt.Coll, []mc.IndexSpec{specs[0], specs[0]})
+		assert.NotNil(t, err)
+	})
+}
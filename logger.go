@@ -0,0 +1,62 @@
+package mongoconnect
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Logger receives the diagnostic output of the package, the key value pairs
+// in args follow the conventions of log/slog so a *slog.Logger can be used
+// directly:
+// mongoconnect.SetLogger(slog.Default())
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// nopLogger discards all output, it is the default Logger
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...any) {}
+func (nopLogger) Info(msg string, args ...any)  {}
+func (nopLogger) Warn(msg string, args ...any)  {}
+func (nopLogger) Error(msg string, args ...any) {}
+
+// loggerHolder gives the stored loggers a single concrete type for atomic.Value
+type loggerHolder struct {
+	Logger
+}
+
+// pkgLogger holds the Logger used by the package
+var pkgLogger atomic.Value
+
+// SetLogger sets the Logger used for the diagnostic output of the package, a
+// nil Logger discards the output
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	pkgLogger.Store(loggerHolder{l})
+}
+
+// logger returns the Logger in use
+func logger() Logger {
+	if h, ok := pkgLogger.Load().(loggerHolder); ok {
+		return h.Logger
+	}
+	return nopLogger{}
+}
+
+// logOp logs the outcome of an operation(op) on collection at debug level, n
+// is the number of records returned or affected
+func logOp(op string, collection *mongo.Collection, duration time.Duration, n int64, err error) {
+	args := []any{"op", op, "collection", collection.Name(), "duration", duration, "count", n}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logger().Debug("mongo operation", args...)
+}
@@ -0,0 +1,74 @@
+package mongoconnect_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+// recordingLogger keeps the logged entries as "level msg key=value..." lines
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []string
+	fields  []map[string]interface{}
+}
+
+func (l *recordingLogger) log(level, msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(args); i += 2 {
+		fields[fmt.Sprint(args[i])] = args[i+1]
+	}
+	l.entries = append(l.entries, level+" "+msg)
+	l.fields = append(l.fields, fields)
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) { l.log("DEBUG", msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...any)  { l.log("INFO", msg, args...) }
+func (l *recordingLogger) Warn(msg string, args ...any)  { l.log("WARN", msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...any) { l.log("ERROR", msg, args...) }
+
+func TestSetLogger(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("operation", func(mt *mtest.T) {
+		l := &recordingLogger{}
+		mc.SetLogger(l)
+		defer mc.SetLogger(nil)
+
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 2}})
+		_, err := mc.RemoveMany(mt.Coll, bson.D{{"name", "john"}})
+		assert.Nil(t, err)
+
+		if assert.Len(t, l.entries, 1) {
+			assert.Equal(t, "DEBUG mongo operation", l.entries[0])
+			assert.Equal(t, mc.OpRemoveMany, l.fields[0]["op"])
+			assert.Equal(t, mt.Coll.Name(), l.fields[0]["collection"])
+			assert.Equal(t, int64(2), l.fields[0]["count"])
+			assert.Contains(t, l.fields[0], "duration")
+			assert.NotContains(t, l.fields[0], "error")
+		}
+	})
+
+	mt.Run("failed connection", func(mt *mtest.T) {
+		l := &recordingLogger{}
+		mc.SetLogger(l)
+		defer mc.SetLogger(nil)
+
+		mt.AddMockResponses(bson.D{{"ok", 0}})
+		assert.False(t, mc.CheckConnection(mt.Client))
+
+		if assert.Len(t, l.entries, 1) {
+			assert.Equal(t, "WARN could not connect to mongo client", l.entries[0])
+			assert.NotNil(t, l.fields[0]["error"])
+		}
+	})
+}
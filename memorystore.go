@@ -0,0 +1,830 @@
+package mongoconnect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryStore is an in-memory implementation of DBCreate and DBInteract to
+// unit test code written against the interfaces without a mongo server.
+// Records are kept per database and collection name of the collection handle,
+// which does not need to be connected:
+// client, _ := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+// collection := client.Database("testdb").Collection("users")
+// Filters support field equality on (dotted) field names, the operators $eq,
+// $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists and the logical $and and $or.
+// Updates support $set, $unset and $inc. The sort, paging and projection of a
+// Query are applied to the finds.
+type MemoryStore struct {
+	mu          sync.Mutex
+	collections map[string][]bson.D
+}
+
+// make sure MemoryStore satisfies the interfaces
+var (
+	_ DBCreate   = (*MemoryStore)(nil)
+	_ DBInteract = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{collections: make(map[string][]bson.D)}
+}
+
+// namespace returns the key the records of collection are kept under
+func namespace(collection *mongo.Collection) string {
+	return collection.Database().Name() + "." + collection.Name()
+}
+
+// CreateEntry adds a record(doc) into Collection(collection), an _id is
+// generated when doc does not carry one
+func (s *MemoryStore) CreateEntry(collection *mongo.Collection, doc bson.D) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := s.insert(namespace(collection), doc, 0)
+	if err != nil {
+		return nil, opError(OpCreateEntry, collection, nil, err)
+	}
+	return id, nil
+}
+
+// CreateEntries adds records(docs) into Collection(collection) unordered, so a
+// failing record does not stop the others from being added. The records that
+// fail are reported in a BatchError and have a nil id.
+func (s *MemoryStore) CreateEntries(collection *mongo.Collection, docs []interface{}) ([]interface{}, error) {
+	if len(docs) == 0 {
+		return nil, opError(OpCreateEntries, collection, nil, mongo.ErrEmptySlice)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns := namespace(collection)
+	ids := make([]interface{}, len(docs))
+	var writeErrors mongo.WriteErrors
+	failed := make(map[int]error)
+	for i, doc := range docs {
+		id, err := s.insert(ns, doc, i)
+		if err != nil {
+			var we mongo.WriteException
+			if !errors.As(err, &we) {
+				return nil, opError(OpCreateEntries, collection, nil, err)
+			}
+			writeErrors = append(writeErrors, we.WriteErrors...)
+			failed[i] = we.WriteErrors[0]
+			continue
+		}
+		ids[i] = id
+	}
+	if len(writeErrors) > 0 {
+		err := &BatchError{Errors: failed, Err: mongo.WriteException{WriteErrors: writeErrors}}
+		return ids, opError(OpCreateEntries, collection, nil, err)
+	}
+	return ids, nil
+}
+
+// insert adds doc to the namespace(ns), index is the position of doc in its
+// batch for reporting write errors
+func (s *MemoryStore) insert(ns string, doc interface{}, index int) (interface{}, error) {
+	record, err := toD(doc)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := lookupD(record, "_id")
+	if !ok {
+		id = primitive.NewObjectID()
+		record = append(bson.D{{Key: "_id", Value: id}}, record...)
+	}
+	for _, existing := range s.collections[ns] {
+		if existingID, _ := lookupD(existing, "_id"); valuesEqual(existingID, id) {
+			return nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+				Index:   index,
+				Code:    11000,
+				Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: _id_ dup key: { _id: %v }", ns, id),
+			}}}
+		}
+	}
+	s.collections[ns] = append(s.collections[ns], record)
+	return id, nil
+}
+
+// SingleItem returns the first record matching filter
+func (s *MemoryStore) SingleItem(collection *mongo.Collection, filter interface{}) (bson.D, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.find(namespace(collection), filter)
+	if err != nil {
+		return nil, opError(OpSingleItem, collection, filter, err)
+	}
+	if len(records) == 0 {
+		return nil, opError(OpSingleItem, collection, filter, mongo.ErrNoDocuments)
+	}
+	return records[0], nil
+}
+
+// AllItems returns all the records in Collection(collection)
+func (s *MemoryStore) AllItems(collection *mongo.Collection) ([]bson.M, error) {
+	return s.findMany(OpAllItems, collection, nil)
+}
+
+// FindManyItems returns all the records matching filter
+func (s *MemoryStore) FindManyItems(collection *mongo.Collection, filter interface{}) ([]bson.M, error) {
+	return s.findMany(OpFindManyItems, collection, filter)
+}
+
+// findMany returns all the records matching filter for the operation(op)
+func (s *MemoryStore) findMany(op string, collection *mongo.Collection, filter interface{}) ([]bson.M, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.find(namespace(collection), filter)
+	if err != nil {
+		return nil, opError(op, collection, filter, err)
+	}
+	var results []bson.M
+	for _, record := range records {
+		result, err := toM(record)
+		if err != nil {
+			return nil, opError(op, collection, filter, fmt.Errorf("could not decode item: %w", err))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Count returns the number of records matching filter, the skip and limit of
+// a Query filter are applied
+func (s *MemoryStore) Count(collection *mongo.Collection, filter interface{}) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.find(namespace(collection), filter)
+	if err != nil {
+		return 0, opError(OpCount, collection, filter, err)
+	}
+	return int64(len(records)), nil
+}
+
+// EstimatedCount returns the number of records in Collection(collection)
+func (s *MemoryStore) EstimatedCount(collection *mongo.Collection) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.collections[namespace(collection)])), nil
+}
+
+// Exists reports whether any record matches filter
+func (s *MemoryStore) Exists(collection *mongo.Collection, filter interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matched, err := s.match(namespace(collection), filter, 1)
+	if err != nil {
+		return false, opError(OpExists, collection, filter, err)
+	}
+	return len(matched) > 0, nil
+}
+
+// Distinct returns the distinct values of field over the records matching
+// filter, the elements of array values count separately
+func (s *MemoryStore) Distinct(collection *mongo.Collection, field string, filter interface{}) ([]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records, err := s.find(namespace(collection), filter)
+	if err != nil {
+		return nil, opError(OpDistinct, collection, filter, err)
+	}
+	var values []interface{}
+	add := func(value interface{}) {
+		for _, v := range values {
+			if valuesEqual(v, value) {
+				return
+			}
+		}
+		values = append(values, value)
+	}
+	for _, record := range records {
+		value, ok := lookupD(record, field)
+		if !ok {
+			continue
+		}
+		if array, ok := value.(bson.A); ok {
+			for _, element := range array {
+				add(element)
+			}
+			continue
+		}
+		add(value)
+	}
+	return values, nil
+}
+
+// RemoveOne deletes the first record matching filter
+func (s *MemoryStore) RemoveOne(collection *mongo.Collection, filter interface{}) (*mongo.DeleteResult, error) {
+	return s.remove(OpRemoveOne, collection, filter, 1)
+}
+
+// RemoveMany deletes all the records matching filter
+func (s *MemoryStore) RemoveMany(collection *mongo.Collection, filter interface{}) (*mongo.DeleteResult, error) {
+	return s.remove(OpRemoveMany, collection, filter, 0)
+}
+
+// remove deletes up to limit records matching filter for the operation(op),
+// a limit of 0 deletes all of them
+func (s *MemoryStore) remove(op string, collection *mongo.Collection, filter interface{}, limit int) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns := namespace(collection)
+	matched, err := s.match(ns, filter, limit)
+	if err != nil {
+		return nil, opError(op, collection, filter, err)
+	}
+	deleted := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		deleted[i] = true
+	}
+	var kept []bson.D
+	for i, record := range s.collections[ns] {
+		if !deleted[i] {
+			kept = append(kept, record)
+		}
+	}
+	s.collections[ns] = kept
+	return &mongo.DeleteResult{DeletedCount: int64(len(matched))}, nil
+}
+
+// UpdateOne applies update to the first record matching filter
+func (s *MemoryStore) UpdateOne(collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	return s.update(OpUpdateOne, collection, filter, update, 1, false, false)
+}
+
+// UpdateMany applies update to all the records matching filter
+func (s *MemoryStore) UpdateMany(collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	return s.update(OpUpdateMany, collection, filter, update, 0, false, false)
+}
+
+// ReplaceOne replaces the first record matching filter with replacement
+func (s *MemoryStore) ReplaceOne(collection *mongo.Collection, filter interface{}, replacement interface{}) (*mongo.UpdateResult, error) {
+	return s.update(OpReplaceOne, collection, filter, replacement, 1, true, false)
+}
+
+// Upsert applies update to the first record matching filter or inserts a new
+// record built from the equality fields of filter when none matches
+func (s *MemoryStore) Upsert(collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+	return s.update(OpUpsert, collection, filter, update, 1, false, true)
+}
+
+// update applies update to up to limit records matching filter for the
+// operation(op), replace treats update as a replacement record and upsert
+// inserts a record when nothing matches
+func (s *MemoryStore) update(op string, collection *mongo.Collection, filter interface{}, update interface{}, limit int, replace bool, upsert bool) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns := namespace(collection)
+	fail := func(err error) (*mongo.UpdateResult, error) {
+		return nil, opError(op, collection, filter, err)
+	}
+
+	changes, err := toD(update)
+	if err != nil {
+		return fail(err)
+	}
+	if err := validateUpdate(changes, replace); err != nil {
+		return fail(err)
+	}
+	matched, err := s.match(ns, filter, limit)
+	if err != nil {
+		return fail(err)
+	}
+
+	res := &mongo.UpdateResult{MatchedCount: int64(len(matched))}
+	if len(matched) == 0 && upsert {
+		record, err := seedFromFilter(filter)
+		if err != nil {
+			return fail(err)
+		}
+		if record, err = applyUpdate(record, changes, replace); err != nil {
+			return fail(err)
+		}
+		id, err := s.insert(ns, record, 0)
+		if err != nil {
+			return fail(err)
+		}
+		res.UpsertedCount = 1
+		res.UpsertedID = id
+		return res, nil
+	}
+
+	for _, i := range matched {
+		record := s.collections[ns][i]
+		updated, err := applyUpdate(record, changes, replace)
+		if err != nil {
+			return fail(err)
+		}
+		before, _ := bson.Marshal(record)
+		after, err := bson.Marshal(updated)
+		if err != nil {
+			return fail(err)
+		}
+		if !bytes.Equal(before, after) {
+			res.ModifiedCount++
+		}
+		s.collections[ns][i] = updated
+	}
+	return res, nil
+}
+
+// find returns copies of the records in the namespace(ns) matching filter,
+// the sort, paging and projection of a Query filter are applied
+func (s *MemoryStore) find(ns string, filter interface{}) ([]bson.D, error) {
+	matched, err := s.match(ns, filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]bson.D, 0, len(matched))
+	for _, i := range matched {
+		record, err := copyD(s.collections[ns][i])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	q, ok := filter.(*Query)
+	if !ok {
+		return records, nil
+	}
+	if len(q.sort) > 0 {
+		sort.SliceStable(records, func(i, j int) bool {
+			for _, key := range q.sort {
+				a, _ := lookupD(records[i], key.Key)
+				b, _ := lookupD(records[j], key.Key)
+				c, _ := compareValues(a, b)
+				if c != 0 {
+					return (c < 0) == (key.Value != -1)
+				}
+			}
+			return false
+		})
+	}
+	if q.skip > 0 {
+		if q.skip >= int64(len(records)) {
+			return nil, nil
+		}
+		records = records[q.skip:]
+	}
+	if q.limit > 0 && q.limit < int64(len(records)) {
+		records = records[:q.limit]
+	}
+	if len(q.projection) > 0 {
+		for i, record := range records {
+			records[i] = project(record, q.projection)
+		}
+	}
+	return records, nil
+}
+
+// project keeps the fields of record the projection includes, or drops the
+// ones it excludes, _id is kept unless excluded explicitly
+func project(record bson.D, projection bson.D) bson.D {
+	include := false
+	fields := make(map[string]bool, len(projection))
+	for _, e := range projection {
+		fields[e.Key] = e.Value != 0
+		if e.Key != "_id" && e.Value != 0 {
+			include = true
+		}
+	}
+	var out bson.D
+	for _, e := range record {
+		keep, listed := fields[e.Key]
+		switch {
+		case listed:
+			if keep {
+				out = append(out, e)
+			}
+		case e.Key == "_id" || !include:
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// match returns the positions of up to limit records in the namespace(ns)
+// matching filter, a limit of 0 returns all of them
+func (s *MemoryStore) match(ns string, filter interface{}, limit int) ([]int, error) {
+	normalized, err := normalizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	conditions, err := toM(normalized)
+	if err != nil {
+		return nil, err
+	}
+	var matched []int
+	for i, record := range s.collections[ns] {
+		doc, err := toM(record)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := matchDocument(doc, conditions)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, i)
+			if limit > 0 && len(matched) == limit {
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// matchDocument reports whether doc satisfies every condition of filter
+func matchDocument(doc bson.M, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var ok bool
+		var err error
+		switch key {
+		case "$and", "$or":
+			ok, err = matchLogical(doc, key, condition)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported query operator %s", key)
+			}
+			value, present := lookupM(doc, key)
+			ok, err = matchField(value, present, condition)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchLogical evaluates the $and or $or operator(op) over its sub filters
+func matchLogical(doc bson.M, op string, condition interface{}) (bool, error) {
+	clauses, ok := condition.(bson.A)
+	if !ok {
+		return false, fmt.Errorf("%s needs an array of filters", op)
+	}
+	for _, clause := range clauses {
+		sub, ok := clause.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array of filters", op)
+		}
+		matched, err := matchDocument(doc, sub)
+		if err != nil {
+			return false, err
+		}
+		if op == "$or" && matched {
+			return true, nil
+		}
+		if op == "$and" && !matched {
+			return false, nil
+		}
+	}
+	return op == "$and", nil
+}
+
+// matchField evaluates a field condition against the field value, present
+// tells if the field exists in the record
+func matchField(value interface{}, present bool, condition interface{}) (bool, error) {
+	operators, ok := condition.(bson.M)
+	if !ok || !isOperatorDocument(operators) {
+		return present && valuesEqual(value, condition), nil
+	}
+	for op, operand := range operators {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = present && valuesEqual(value, operand)
+		case "$ne":
+			ok = !present || !valuesEqual(value, operand)
+		case "$gt", "$gte", "$lt", "$lte":
+			c, comparable := compareValues(value, operand)
+			ok = present && comparable && ((op == "$gt" && c > 0) || (op == "$gte" && c >= 0) ||
+				(op == "$lt" && c < 0) || (op == "$lte" && c <= 0))
+		case "$in", "$nin":
+			candidates, isArray := operand.(bson.A)
+			if !isArray {
+				return false, fmt.Errorf("%s needs an array", op)
+			}
+			found := false
+			for _, candidate := range candidates {
+				if present && valuesEqual(value, candidate) {
+					found = true
+					break
+				}
+			}
+			ok = found == (op == "$in")
+		case "$exists":
+			want, isBool := operand.(bool)
+			if !isBool {
+				return false, errors.New("$exists needs a boolean")
+			}
+			ok = present == want
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", op)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// isOperatorDocument reports whether every key of doc is an operator
+func isOperatorDocument(doc bson.M) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// valuesEqual compares two decoded values, numbers compare by value whatever
+// their type and an array equals a value it contains
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x == y
+		}
+	}
+	if arr, ok := a.(bson.A); ok {
+		if _, bothArrays := b.(bson.A); !bothArrays {
+			for _, elem := range arr {
+				if valuesEqual(elem, b) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compareValues orders two decoded values of the same kind, ok is false when
+// they can not be compared
+func compareValues(a, b interface{}) (c int, ok bool) {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case primitive.DateTime:
+		if y, ok := b.(primitive.DateTime); ok {
+			return compareValues(int64(x), int64(y))
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(x[:], y[:]), true
+		}
+	}
+	return 0, false
+}
+
+// toFloat converts a decoded number to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// validateUpdate checks update holds only operators, or none for a replacement
+func validateUpdate(update bson.D, replace bool) error {
+	for _, e := range update {
+		isOperator := strings.HasPrefix(e.Key, "$")
+		if replace && isOperator {
+			return errors.New("replacement document cannot contain keys beginning with '$'")
+		}
+		if !replace && !isOperator {
+			return errors.New("update document must contain key beginning with '$'")
+		}
+	}
+	if !replace && len(update) == 0 {
+		return errors.New("update document must contain key beginning with '$'")
+	}
+	return nil
+}
+
+// applyUpdate returns a copy of record with update applied, the _id of record
+// is kept for replacements
+func applyUpdate(record bson.D, update bson.D, replace bool) (bson.D, error) {
+	if replace {
+		replacement, err := copyD(update)
+		if err != nil {
+			return nil, err
+		}
+		if id, ok := lookupD(record, "_id"); ok {
+			replacement = append(bson.D{{Key: "_id", Value: id}}, unsetPath(replacement, []string{"_id"})...)
+		}
+		return replacement, nil
+	}
+
+	updated, err := copyD(record)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range update {
+		fields, ok := e.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a document", e.Key)
+		}
+		for _, field := range fields {
+			path := strings.Split(field.Key, ".")
+			switch e.Key {
+			case "$set":
+				updated = setPath(updated, path, field.Value)
+			case "$unset":
+				updated = unsetPath(updated, path)
+			case "$inc":
+				current, _ := lookupD(updated, field.Key)
+				sum, err := addNumbers(current, field.Value)
+				if err != nil {
+					return nil, fmt.Errorf("cannot apply $inc to %s: %w", field.Key, err)
+				}
+				updated = setPath(updated, path, sum)
+			default:
+				return nil, fmt.Errorf("unsupported update operator %s", e.Key)
+			}
+		}
+	}
+	return updated, nil
+}
+
+// addNumbers adds two decoded numbers keeping integer types where possible, a
+// nil current value counts as zero
+func addNumbers(current, inc interface{}) (interface{}, error) {
+	if current == nil {
+		current = int32(0)
+	}
+	switch x := current.(type) {
+	case int32:
+		if y, ok := inc.(int32); ok {
+			return x + y, nil
+		}
+		if y, ok := inc.(int64); ok {
+			return int64(x) + y, nil
+		}
+	case int64:
+		switch y := inc.(type) {
+		case int32:
+			return x + int64(y), nil
+		case int64:
+			return x + y, nil
+		}
+	}
+	x, ok := toFloat(current)
+	y, ok2 := toFloat(inc)
+	if !ok || !ok2 {
+		return nil, errors.New("non-numeric value")
+	}
+	return x + y, nil
+}
+
+// seedFromFilter returns the record an upsert starts from, made of the plain
+// equality fields of filter
+func seedFromFilter(filter interface{}) (bson.D, error) {
+	normalized, err := normalizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	conditions, err := toD(normalized)
+	if err != nil {
+		return nil, err
+	}
+	seed := bson.D{}
+	for _, e := range conditions {
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+		if operators, ok := e.Value.(bson.D); ok && len(operators) > 0 && strings.HasPrefix(operators[0].Key, "$") {
+			continue
+		}
+		seed = setPath(seed, strings.Split(e.Key, "."), e.Value)
+	}
+	return seed, nil
+}
+
+// setPath sets the field at path in doc creating intermediate documents
+func setPath(doc bson.D, path []string, value interface{}) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = value
+			return doc
+		}
+		sub, _ := e.Value.(bson.D)
+		doc[i].Value = setPath(sub, path[1:], value)
+		return doc
+	}
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: value})
+	}
+	return append(doc, bson.E{Key: path[0], Value: setPath(bson.D{}, path[1:], value)})
+}
+
+// unsetPath removes the field at path from doc
+func unsetPath(doc bson.D, path []string) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+		if sub, ok := e.Value.(bson.D); ok {
+			doc[i].Value = unsetPath(sub, path[1:])
+		}
+		return doc
+	}
+	return doc
+}
+
+// lookupD returns the value of the (dotted) field key in doc
+func lookupD(doc bson.D, key string) (interface{}, bool) {
+	path := strings.Split(key, ".")
+	for _, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return e.Value, true
+		}
+		if sub, ok := e.Value.(bson.D); ok {
+			return lookupD(sub, strings.Join(path[1:], "."))
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// lookupM returns the value of the (dotted) field key in doc
+func lookupM(doc bson.M, key string) (interface{}, bool) {
+	path := strings.Split(key, ".")
+	value, ok := doc[path[0]]
+	if !ok || len(path) == 1 {
+		return value, ok
+	}
+	if sub, isDoc := value.(bson.M); isDoc {
+		return lookupM(sub, strings.Join(path[1:], "."))
+	}
+	return nil, false
+}
+
+// toD converts any document shaped value to a bson.D
+func toD(v interface{}) (bson.D, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	err = bson.Unmarshal(raw, &d)
+	return d, err
+}
+
+// toM converts any document shaped value to a bson.M
+func toM(v interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m bson.M
+	err = bson.Unmarshal(raw, &m)
+	return m, err
+}
+
+// copyD returns a deep copy of doc
+func copyD(doc bson.D) (bson.D, error) {
+	return toD(doc)
+}
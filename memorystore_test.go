@@ -0,0 +1,152 @@
+package mongoconnect_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+// newTestCollection returns an unconnected collection handle
+func newTestCollection(t *testing.T, name string) *mongo.Collection {
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.Database("testdb").Collection(name)
+}
+
+func TestMemoryStore(t *testing.T) {
+	var (
+		creator    mc.DBCreate   = mc.NewMemoryStore()
+		interactor mc.DBInteract = creator.(mc.DBInteract)
+	)
+	coll := newTestCollection(t, "users")
+
+	ids, err := creator.CreateEntries(coll, []interface{}{
+		bson.D{{"name", "john"}, {"email", "testEmail1"}, {"age", 30}},
+		bson.D{{"name", "john"}, {"email", "testEmail2"}, {"age", 40}},
+		mc.User{Name: "jane", Email: "testEmail3"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, ids, 3)
+
+	t.Run("duplicate id", func(t *testing.T) {
+		_, err := creator.CreateEntry(coll, bson.D{{"_id", ids[0]}})
+		assert.ErrorIs(t, err, mc.ErrDuplicateKey)
+
+		batch, err := creator.CreateEntries(newTestCollection(t, "batch"), []interface{}{
+			bson.D{{"_id", 1}},
+			bson.D{{"_id", 1}},
+			bson.D{{"_id", 2}},
+		})
+		assert.ErrorIs(t, err, mc.ErrDuplicateKey)
+		var batchErr *mc.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, []int{1}, batchErr.Failed())
+		assert.Equal(t, []interface{}{int32(1), nil, int32(2)}, batch)
+	})
+
+	t.Run("collections are separate", func(t *testing.T) {
+		items, err := interactor.AllItems(newTestCollection(t, "others"))
+		assert.Nil(t, err)
+		assert.Empty(t, items)
+	})
+
+	t.Run("single item", func(t *testing.T) {
+		item, err := interactor.SingleItem(coll, bson.D{{"email", "testEmail2"}})
+		assert.Nil(t, err)
+		assert.Equal(t, bson.D{{"_id", ids[1]}, {"name", "john"}, {"email", "testEmail2"}, {"age", int32(40)}}, item)
+
+		_, err = interactor.SingleItem(coll, bson.D{{"email", "nobody"}})
+		assert.ErrorIs(t, err, mc.ErrNotFound)
+	})
+
+	t.Run("find with operators", func(t *testing.T) {
+		items, err := interactor.FindManyItems(coll, bson.M{"name": "john", "age": bson.M{"$gt": 35}})
+		assert.Nil(t, err)
+		assert.Len(t, items, 1)
+		assert.Equal(t, "testEmail2", items[0]["email"])
+
+		items, err = interactor.FindManyItems(coll, bson.D{{"$or", bson.A{
+			bson.D{{"name", "jane"}},
+			bson.D{{"age", bson.D{{"$lte", 30}}}},
+		}}})
+		assert.Nil(t, err)
+		assert.Len(t, items, 2)
+	})
+
+	t.Run("count and distinct", func(t *testing.T) {
+		count, err := interactor.Count(coll, bson.D{{"name", "john"}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), count)
+
+		count, err = interactor.Count(coll, mc.Where("name").Eq("john").Skip(1))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), count)
+
+		count, err = interactor.EstimatedCount(coll)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), count)
+
+		exists, err := interactor.Exists(coll, bson.D{{"email", "nobody"}})
+		assert.Nil(t, err)
+		assert.False(t, exists)
+
+		names, err := interactor.Distinct(coll, "name", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{"john", "jane"}, names)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		res, err := interactor.UpdateMany(coll, bson.D{{"name", "john"}}, bson.D{{"$inc", bson.D{{"age", 1}}}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), res.MatchedCount)
+		assert.Equal(t, int64(2), res.ModifiedCount)
+
+		res, err = interactor.UpdateOne(coll, bson.D{{"email", "testEmail1"}}, bson.D{{"$set", bson.D{{"address.city", "Cape Town"}}}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.ModifiedCount)
+		item, err := interactor.SingleItem(coll, bson.D{{"address.city", "Cape Town"}})
+		assert.Nil(t, err)
+		assert.Equal(t, ids[0], item[0].Value)
+
+		_, err = interactor.UpdateOne(coll, bson.D{{"email", "testEmail1"}}, bson.D{{"age", 1}})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		res, err := interactor.ReplaceOne(coll, bson.D{{"email", "testEmail3"}}, bson.D{{"name", "janet"}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.ModifiedCount)
+		item, err := interactor.SingleItem(coll, bson.D{{"name", "janet"}})
+		assert.Nil(t, err)
+		assert.Equal(t, bson.D{{"_id", ids[2]}, {"name", "janet"}}, item)
+	})
+
+	t.Run("upsert", func(t *testing.T) {
+		res, err := interactor.Upsert(coll, bson.D{{"name", "bob"}}, bson.D{{"$set", bson.D{{"email", "testEmail4"}}}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.UpsertedCount)
+		assert.NotNil(t, res.UpsertedID)
+		item, err := interactor.SingleItem(coll, bson.D{{"email", "testEmail4"}})
+		assert.Nil(t, err)
+		assert.Equal(t, bson.D{{"_id", res.UpsertedID}, {"name", "bob"}, {"email", "testEmail4"}}, item)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		res, err := interactor.RemoveOne(coll, bson.D{{"name", "bob"}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.DeletedCount)
+		res, err = interactor.RemoveMany(coll, bson.M{"name": bson.M{"$in": bson.A{"john", "janet"}}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), res.DeletedCount)
+		items, err := interactor.AllItems(coll)
+		assert.Nil(t, err)
+		assert.Empty(t, items)
+	})
+}
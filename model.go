@@ -0,0 +1,470 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Model is a type registered as the records of a collection. Its indexes and
+// validator come from the mongo tags of its fields, next to their bson tags:
+// type User struct {
+// Email string `bson:"email" mongo:"index,unique,required"`
+// }
+// The options of a mongo tag are
+// index: index the field ascending, desc indexes it descending
+// index=<name>: index the field in the compound index(name), in field order
+// unique: the index rejects a key that is already in it, implies index
+// ttl=<duration>: remove records this long after the time in the field
+// text: index the field in the text index of the collection
+// required: records must have the field
+// min=<n>, max=<n>: bounds of a number field
+// minLength=<n>, maxLength=<n>: bounds of the length of a string field
+// enum=<a|b|c>: the values the field may take
+type Model struct {
+	// Collection is the name of the collection holding the records
+	Collection string
+	// Type is the registered type
+	Type reflect.Type
+	// Indexes are the indexes declared on the fields
+	Indexes []IndexSpec
+	// Schema is the $jsonSchema describing the records
+	Schema bson.D
+}
+
+// Validator returns the validator enforcing the Schema of the Model
+func (m *Model) Validator() bson.D {
+	return bson.D{{Key: "$jsonSchema", Value: m.Schema}}
+}
+
+var (
+	modelsMu sync.RWMutex
+	models   = make(map[string]*Model)
+)
+
+// RegisterModel registers T as the records of the collection(collection) and
+// returns its Model, registering a collection again replaces its Model
+func RegisterModel[T any](collection string) (*Model, error) {
+	model, err := newModel(collection, reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models[collection] = model
+	return model, nil
+}
+
+// Models returns the registered models ordered by collection
+func Models() []*Model {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	out := make([]*Model, 0, len(models))
+	for _, model := range models {
+		out = append(out, model)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Collection < out[j].Collection })
+	return out
+}
+
+// NewModel reflects over the type of the struct(v) and returns its Model for
+// the collection(collection) without registering it
+func NewModel(collection string, v interface{}) (*Model, error) {
+	if v == nil {
+		return nil, errors.New("model is nil")
+	}
+	return newModel(collection, reflect.TypeOf(v))
+}
+
+// newModel returns the Model of the struct type(typ)
+func newModel(collection string, typ reflect.Type) (*Model, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("model %s is not a struct", typ)
+	}
+	b := &modelBuilder{groups: make(map[string]int), expanding: make(map[reflect.Type]bool)}
+	schema, err := b.object(typ, "")
+	if err != nil {
+		return nil, fmt.Errorf("model %s: %w", typ, err)
+	}
+	if len(b.text) > 0 {
+		b.indexes = append(b.indexes, IndexSpec{Keys: TextIndexKeys(b.text...)})
+	}
+	return &Model{Collection: collection, Type: typ, Indexes: b.indexes, Schema: schema}, nil
+}
+
+// EnsureModels applies the validators and indexes of the registered models to
+// their collections in database, creating the collections that do not exist
+func EnsureModels(ctx context.Context, database *mongo.Database, opts ...Option) error {
+	for _, model := range Models() {
+		if err := EnsureModel(ctx, database, model, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureModel applies the validator and indexes of model to its collection in
+// database, creating the collection when it does not exist
+func EnsureModel(ctx context.Context, database *mongo.Database, model *Model, opts ...Option) error {
+	if database == nil {
+		return opError(OpEnsureModel, nil, nil, ErrNotConnected)
+	}
+	collection := database.Collection(model.Collection)
+	err := run(ctx, resolve(opts), OpEnsureModel, collection, nil, func(ctx context.Context, collection *mongo.Collection, _ interface{}) (int64, error) {
+		err := database.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: model.Collection},
+			{Key: "validator", Value: model.Validator()},
+		}).Err()
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+			err = database.CreateCollection(ctx, model.Collection, options.CreateCollection().SetValidator(model.Validator()))
+		}
+		if err != nil {
+			return 0, fmt.Errorf("could not set validator: %w", err)
+		}
+		return 1, nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = EnsureIndexes(ctx, collection, model.Indexes, opts...)
+	return err
+}
+
+// modelBuilder collects the indexes of a model while its schema is built
+type modelBuilder struct {
+	indexes []IndexSpec
+	// groups maps the compound index names to their position in indexes
+	groups map[string]int
+	text   []string
+	// expanding holds the struct types whose fields are being added, so a
+	// type holding itself is described once
+	expanding map[reflect.Type]bool
+}
+
+// fieldTag is the parsed mongo tag of a field
+type fieldTag struct {
+	index     bool
+	group     string
+	desc      bool
+	unique    bool
+	ttl       time.Duration
+	text      bool
+	required  bool
+	schema    bson.D
+	enumerate bson.A
+}
+
+// object returns the schema of the struct type(typ) whose fields are found
+// under the (dotted) path(prefix)
+func (b *modelBuilder) object(typ reflect.Type, prefix string) (bson.D, error) {
+	if b.expanding[typ] {
+		// a type nested in itself, like the children of a tree node, is
+		// described by its outermost occurrence only
+		return bson.D{{Key: "bsonType", Value: "object"}}, nil
+	}
+	b.expanding[typ] = true
+	defer delete(b.expanding, typ)
+
+	properties := bson.D{}
+	var required bson.A
+	if err := b.fields(typ, prefix, &properties, &required); err != nil {
+		return nil, err
+	}
+	schema := bson.D{{Key: "bsonType", Value: "object"}}
+	if len(required) > 0 {
+		schema = append(schema, bson.E{Key: "required", Value: required})
+	}
+	return append(schema, bson.E{Key: "properties", Value: properties}), nil
+}
+
+// fields adds the properties and required fields of the struct type(typ) and
+// collects the indexes declared on them
+func (b *modelBuilder) fields(typ reflect.Type, prefix string, properties *bson.D, required *bson.A) error {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// unexported fields are not stored
+			continue
+		}
+		name, inline, skip := bsonName(field)
+		if skip {
+			continue
+		}
+		if inline {
+			inner := field.Type
+			for inner.Kind() == reflect.Ptr {
+				inner = inner.Elem()
+			}
+			if inner.Kind() != reflect.Struct {
+				return fmt.Errorf("field %s: only structs can be inlined", field.Name)
+			}
+			if b.expanding[inner] {
+				return fmt.Errorf("field %s: %s is inlined in itself", field.Name, inner)
+			}
+			b.expanding[inner] = true
+			err := b.fields(inner, prefix, properties, required)
+			delete(b.expanding, inner)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		path := prefix + name
+		tag, err := parseFieldTag(field.Tag.Get("mongo"))
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		b.addIndex(path, tag)
+
+		schema, err := b.schema(field.Type, path+".")
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		schema = append(schema, tag.schema...)
+		if tag.enumerate != nil {
+			schema = append(schema, bson.E{Key: "enum", Value: tag.enumerate})
+		}
+		*properties = append(*properties, bson.E{Key: name, Value: schema})
+		if tag.required {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
+
+// addIndex adds the index tag declares on the field at path
+func (b *modelBuilder) addIndex(path string, tag fieldTag) {
+	if tag.text {
+		b.text = append(b.text, path)
+	}
+	if !tag.index {
+		return
+	}
+	order := 1
+	if tag.desc {
+		order = -1
+	}
+	key := bson.E{Key: path, Value: order}
+	if tag.group == "" {
+		b.indexes = append(b.indexes, IndexSpec{Keys: bson.D{key}, Unique: tag.unique, ExpireAfter: tag.ttl})
+		return
+	}
+	i, ok := b.groups[tag.group]
+	if !ok {
+		b.groups[tag.group] = len(b.indexes)
+		b.indexes = append(b.indexes, IndexSpec{Name: tag.group, Keys: bson.D{key}, Unique: tag.unique})
+		return
+	}
+	b.indexes[i].Keys = append(b.indexes[i].Keys, key)
+	b.indexes[i].Unique = b.indexes[i].Unique || tag.unique
+}
+
+// schema returns the schema of a field of type(typ), fields of nested structs
+// are found under the (dotted) path(prefix)
+func (b *modelBuilder) schema(typ reflect.Type, prefix string) (bson.D, error) {
+	if typ.Kind() == reflect.Ptr {
+		schema, err := b.schema(typ.Elem(), prefix)
+		if err != nil {
+			return nil, err
+		}
+		// a nil pointer is stored as null
+		return nullable(schema), nil
+	}
+
+	switch typ {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(primitive.DateTime(0)):
+		return bson.D{{Key: "bsonType", Value: "date"}}, nil
+	case reflect.TypeOf(primitive.ObjectID{}):
+		return bson.D{{Key: "bsonType", Value: "objectId"}}, nil
+	case reflect.TypeOf(primitive.Decimal128{}):
+		return bson.D{{Key: "bsonType", Value: "decimal"}}, nil
+	case reflect.TypeOf([]byte{}):
+		// a nil slice is stored as null
+		return nullable(bson.D{{Key: "bsonType", Value: "binData"}}), nil
+	case reflect.TypeOf(primitive.Binary{}):
+		return bson.D{{Key: "bsonType", Value: "binData"}}, nil
+	case reflect.TypeOf(bson.D{}):
+		return nullable(bson.D{{Key: "bsonType", Value: "object"}}), nil
+	case reflect.TypeOf(bson.Raw{}):
+		return bson.D{{Key: "bsonType", Value: "object"}}, nil
+	case reflect.TypeOf(primitive.Timestamp{}):
+		return bson.D{{Key: "bsonType", Value: "timestamp"}}, nil
+	case reflect.TypeOf(primitive.Regex{}):
+		return bson.D{{Key: "bsonType", Value: "regex"}}, nil
+	case reflect.TypeOf(primitive.JavaScript("")):
+		return bson.D{{Key: "bsonType", Value: "javascript"}}, nil
+	case reflect.TypeOf(primitive.CodeWithScope{}):
+		return bson.D{{Key: "bsonType", Value: "javascriptWithScope"}}, nil
+	case reflect.TypeOf(primitive.Symbol("")):
+		return bson.D{{Key: "bsonType", Value: "symbol"}}, nil
+	case reflect.TypeOf(primitive.DBPointer{}):
+		return bson.D{{Key: "bsonType", Value: "dbPointer"}}, nil
+	case reflect.TypeOf(primitive.MinKey{}):
+		return bson.D{{Key: "bsonType", Value: "minKey"}}, nil
+	case reflect.TypeOf(primitive.MaxKey{}):
+		return bson.D{{Key: "bsonType", Value: "maxKey"}}, nil
+	case reflect.TypeOf(primitive.Null{}):
+		return bson.D{{Key: "bsonType", Value: "null"}}, nil
+	case reflect.TypeOf(primitive.Undefined{}):
+		return bson.D{{Key: "bsonType", Value: "undefined"}}, nil
+	}
+	if implements(typ, marshalerType) || implements(typ, valueMarshalerType) {
+		// the type decides how it is stored, so any value is accepted
+		return bson.D{}, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return bson.D{{Key: "bsonType", Value: "string"}}, nil
+	case reflect.Bool:
+		return bson.D{{Key: "bsonType", Value: "bool"}}, nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return bson.D{{Key: "bsonType", Value: "int"}}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		// int is stored as an int or a long depending on its value
+		return bson.D{{Key: "bsonType", Value: bson.A{"int", "long"}}}, nil
+	case reflect.Float32, reflect.Float64:
+		return bson.D{{Key: "bsonType", Value: "double"}}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := b.schema(typ.Elem(), prefix)
+		if err != nil {
+			return nil, err
+		}
+		schema := bson.D{{Key: "bsonType", Value: "array"}}
+		if len(items) > 0 {
+			schema = append(schema, bson.E{Key: "items", Value: items})
+		}
+		if typ.Kind() == reflect.Slice {
+			// a nil slice is stored as null
+			schema = nullable(schema)
+		}
+		return schema, nil
+	case reflect.Map:
+		// a nil map is stored as null
+		return nullable(bson.D{{Key: "bsonType", Value: "object"}}), nil
+	case reflect.Struct:
+		return b.object(typ, prefix)
+	}
+	// interface{} and the other types take any value
+	return bson.D{}, nil
+}
+
+// nullable returns schema accepting null too, a schema without a bsonType
+// already accepts any value
+func nullable(schema bson.D) bson.D {
+	if len(schema) == 0 || schema[0].Key != "bsonType" {
+		return schema
+	}
+	switch types := schema[0].Value.(type) {
+	case string:
+		if types != "null" {
+			schema[0].Value = bson.A{types, "null"}
+		}
+	case bson.A:
+		for _, t := range types {
+			if t == "null" {
+				return schema
+			}
+		}
+		schema[0].Value = append(types, "null")
+	}
+	return schema
+}
+
+var (
+	marshalerType      = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+	valueMarshalerType = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+)
+
+// implements reports whether typ or a pointer to it implements iface
+func implements(typ, iface reflect.Type) bool {
+	return typ.Implements(iface) || reflect.PtrTo(typ).Implements(iface)
+}
+
+// bsonName returns the name a struct field is stored under the way the bson
+// package derives it, inline tells the fields of the field are stored in the
+// record itself and skip that the field is not stored
+func bsonName(field reflect.StructField) (name string, inline bool, skip bool) {
+	tag, ok := field.Tag.Lookup("bson")
+	if !ok && !strings.Contains(string(field.Tag), ":") {
+		tag = string(field.Tag)
+	}
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if option == "inline" {
+			inline = true
+		}
+	}
+	name = parts[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, inline, false
+}
+
+// parseFieldTag parses the options of a mongo tag
+func parseFieldTag(tag string) (fieldTag, error) {
+	var t fieldTag
+	if tag == "" {
+		return t, nil
+	}
+	for _, option := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(option, "=")
+		var err error
+		switch key {
+		case "index":
+			t.index, t.group = true, value
+		case "desc":
+			t.index, t.desc = true, true
+		case "unique":
+			t.index, t.unique = true, true
+		case "ttl":
+			t.index = true
+			t.ttl, err = time.ParseDuration(value)
+		case "text":
+			t.text = true
+		case "required":
+			t.required = true
+		case "min", "max":
+			var n float64
+			n, err = strconv.ParseFloat(value, 64)
+			t.schema = append(t.schema, bson.E{Key: key + "imum", Value: n})
+		case "minLength", "maxLength":
+			var n int64
+			n, err = strconv.ParseInt(value, 10, 64)
+			t.schema = append(t.schema, bson.E{Key: key, Value: n})
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				t.enumerate = append(t.enumerate, v)
+			}
+		default:
+			return t, fmt.Errorf("unknown mongo tag option %q", option)
+		}
+		if err != nil {
+			return t, fmt.Errorf("mongo tag option %q: %w", option, err)
+		}
+	}
+	if t.ttl > 0 && t.group != "" {
+		return t, errors.New("a ttl index can not be compound")
+	}
+	return t, nil
+}
@@ -0,0 +1,243 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+type address struct {
+	City string `bson:"city" mongo:"index"`
+}
+
+type Audit struct {
+	Created time.Time `bson:"created" mongo:"ttl=720h"`
+}
+
+type account struct {
+	Audit   `bson:",inline"`
+	Email   string   `bson:"email" mongo:"unique,required"`
+	Country string   `bson:"country" mongo:"index=country_age"`
+	Age     int      `bson:"age" mongo:"index=country_age,desc,min=0,max=150"`
+	Status  string   `bson:"status,omitempty" mongo:"enum=active|closed"`
+	Bio     *string  `bson:"bio" mongo:"text,maxLength=500"`
+	Tags    []string `bson:"tags"`
+	Address address  `bson:"address"`
+	Ignored string   `bson:"-"`
+}
+
+type node struct {
+	Name     string `bson:"name" mongo:"index"`
+	Parent   *node  `bson:"parent"`
+	Children []node `bson:"children"`
+}
+
+// status is stored by its own MarshalBSONValue
+type status int
+
+func (s status) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(strconv.Itoa(int(s)))
+}
+
+type event struct {
+	Meta    bson.D              `bson:"meta"`
+	Raw     bson.Raw            `bson:"raw"`
+	At      primitive.Timestamp `bson:"at"`
+	Payload primitive.Binary    `bson:"payload"`
+	Pattern primitive.Regex     `bson:"pattern"`
+	Status  status              `bson:"status"`
+	Blob    []byte              `bson:"blob"`
+	Labels  map[string]string   `bson:"labels"`
+}
+
+// bsonTypes names the BSON types in a $jsonSchema
+var bsonTypes = map[bsontype.Type]string{
+	bson.TypeString:           "string",
+	bson.TypeInt32:            "int",
+	bson.TypeInt64:            "long",
+	bson.TypeDouble:           "double",
+	bson.TypeBoolean:          "bool",
+	bson.TypeDateTime:         "date",
+	bson.TypeNull:             "null",
+	bson.TypeArray:            "array",
+	bson.TypeEmbeddedDocument: "object",
+	bson.TypeBinary:           "binData",
+	bson.TypeTimestamp:        "timestamp",
+	bson.TypeRegex:            "regex",
+}
+
+// allows reports whether schema accepts a value of type typ
+func allows(schema bson.D, typ bsontype.Type) bool {
+	types, ok := schema.Map()["bsonType"]
+	if !ok {
+		return true
+	}
+	if name, ok := types.(string); ok {
+		return name == bsonTypes[typ]
+	}
+	for _, name := range types.(bson.A) {
+		if name == bsonTypes[typ] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewModel(t *testing.T) {
+	t.Run("User", func(t *testing.T) {
+		model, err := mc.NewModel("users", mc.User{})
+		assert.Nil(t, err)
+		assert.Equal(t, []mc.IndexSpec{{Keys: bson.D{{"email", 1}}, Unique: true}}, model.Indexes)
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		model, err := mc.NewModel("accounts", &account{})
+		assert.Nil(t, err)
+		assert.Equal(t, []mc.IndexSpec{
+			{Keys: bson.D{{"created", 1}}, ExpireAfter: 720 * time.Hour},
+			{Keys: bson.D{{"email", 1}}, Unique: true},
+			{Name: "country_age", Keys: bson.D{{"country", 1}, {"age", -1}}},
+			{Keys: bson.D{{"address.city", 1}}},
+			{Keys: bson.D{{"bio", "text"}}},
+		}, model.Indexes)
+
+		assert.Equal(t, bson.D{{"$jsonSchema", bson.D{
+			{"bsonType", "object"},
+			{"required", bson.A{"email"}},
+			{"properties", bson.D{
+				{"created", bson.D{{"bsonType", "date"}}},
+				{"email", bson.D{{"bsonType", "string"}}},
+				{"country", bson.D{{"bsonType", "string"}}},
+				{"age", bson.D{{"bsonType", bson.A{"int", "long"}}, {"minimum", 0.0}, {"maximum", 150.0}}},
+				{"status", bson.D{{"bsonType", "string"}, {"enum", bson.A{"active", "closed"}}}},
+				{"bio", bson.D{{"bsonType", bson.A{"string", "null"}}, {"maxLength", int64(500)}}},
+				{"tags", bson.D{{"bsonType", bson.A{"array", "null"}}, {"items", bson.D{{"bsonType", "string"}}}}},
+				{"address", bson.D{{"bsonType", "object"}, {"properties", bson.D{
+					{"city", bson.D{{"bsonType", "string"}}},
+				}}}},
+			}},
+		}}}, model.Validator())
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		model, err := mc.NewModel("nodes", node{})
+		assert.Nil(t, err)
+		assert.Equal(t, []mc.IndexSpec{{Keys: bson.D{{"name", 1}}}}, model.Indexes)
+		assert.Equal(t, bson.D{
+			{"bsonType", "object"},
+			{"properties", bson.D{
+				{"name", bson.D{{"bsonType", "string"}}},
+				{"parent", bson.D{{"bsonType", bson.A{"object", "null"}}}},
+				{"children", bson.D{{"bsonType", bson.A{"array", "null"}}, {"items", bson.D{{"bsonType", "object"}}}}},
+			}},
+		}, model.Schema)
+
+		type Loop struct {
+			*Loop `bson:",inline"`
+		}
+		_, err = mc.NewModel("loops", Loop{})
+		assert.ErrorContains(t, err, "inlined in itself")
+	})
+
+	t.Run("driver types", func(t *testing.T) {
+		model, err := mc.NewModel("events", event{})
+		assert.Nil(t, err)
+		assert.Equal(t, bson.D{
+			{"bsonType", "object"},
+			{"properties", bson.D{
+				{"meta", bson.D{{"bsonType", bson.A{"object", "null"}}}},
+				{"raw", bson.D{{"bsonType", "object"}}},
+				{"at", bson.D{{"bsonType", "timestamp"}}},
+				{"payload", bson.D{{"bsonType", "binData"}}},
+				{"pattern", bson.D{{"bsonType", "regex"}}},
+				{"status", bson.D{}},
+				{"blob", bson.D{{"bsonType", bson.A{"binData", "null"}}}},
+				{"labels", bson.D{{"bsonType", bson.A{"object", "null"}}}},
+			}},
+		}, model.Schema)
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		// the zero value of a model passes its own validator, a nil bson.Raw
+		// can not be marshalled at all
+		for _, v := range []interface{}{account{}, node{}, event{Raw: bson.Raw(bsoncore.NewDocumentBuilder().Build())}} {
+			model, err := mc.NewModel("zero", v)
+			assert.Nil(t, err)
+			raw, err := bson.Marshal(v)
+			assert.Nil(t, err)
+			elements, err := bson.Raw(raw).Elements()
+			assert.Nil(t, err)
+			for _, e := range elements {
+				schema := model.Schema.Map()["properties"].(bson.D).Map()[e.Key()].(bson.D)
+				assert.True(t, allows(schema, e.Value().Type), "%T.%s is %s", v, e.Key(), e.Value().Type)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := mc.NewModel("numbers", 42)
+		assert.NotNil(t, err)
+
+		type bad struct {
+			Name string `bson:"name" mongo:"indexed"`
+		}
+		_, err = mc.NewModel("bad", bad{})
+		assert.ErrorContains(t, err, "unknown mongo tag option")
+	})
+}
+
+func TestRegisterModel(t *testing.T) {
+	model, err := mc.RegisterModel[mc.User]("users")
+	assert.Nil(t, err)
+	assert.Contains(t, mc.Models(), model)
+}
+
+func TestEnsureModel(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+	model, err := mc.NewModel("users", mc.User{})
+	assert.Nil(t, err)
+
+	mt.Run("existing collection", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "foo.users", mtest.FirstBatch, bson.D{{"key", bson.D{{"_id", 1}}}, {"name", "_id_"}}),
+			mtest.CreateSuccessResponse(),
+		)
+		assert.Nil(t, mc.EnsureModel(ctx, mt.DB, model))
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(t, "users", cmd.Lookup("collMod").StringValue())
+		assert.Equal(t, "string", cmd.Lookup("validator", "$jsonSchema", "properties", "email", "bsonType").StringValue())
+		assert.Equal(t, "listIndexes", mt.GetStartedEvent().CommandName)
+		assert.Equal(t, "email_1", mt.GetStartedEvent().Command.Lookup("indexes", "0", "name").StringValue())
+	})
+
+	mt.Run("new collection", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 26, Name: "NamespaceNotFound", Message: "ns does not exist"}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "foo.users", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+		)
+		assert.Nil(t, mc.EnsureModel(ctx, mt.DB, model))
+		mt.GetStartedEvent()
+		create := mt.GetStartedEvent().Command
+		assert.Equal(t, "users", create.Lookup("create").StringValue())
+		assert.NotNil(t, create.Lookup("validator", "$jsonSchema").Document())
+	})
+
+	mt.Run("not connected", func(mt *mtest.T) {
+		assert.ErrorIs(t, mc.EnsureModel(ctx, nil, model), mc.ErrNotConnected)
+	})
+}
@@ -1,12 +1,17 @@
 package mongoconnect_test
 
 import (
+	"context"
 	"fmt"
-	"strings"
+	"reflect"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"testing"
 
@@ -20,7 +25,6 @@ func TestCheckConnection(t *testing.T) {
 	defer mt.Close()
 
 	mt.Run("success", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
 		// create a mock client
 		client := mt.Client
 
@@ -40,7 +44,7 @@ func TestSingleItem(t *testing.T) {
 	defer mt.Close()
 
 	mt.Run("success", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		// create a user as a test BSON.D entry
 		expectedObject := object
 
@@ -48,10 +52,24 @@ func TestSingleItem(t *testing.T) {
 			{"john", "testname1"},
 		}))
 		filter := object
-		objectResponse, err := mc.SingleItem(mc.Collection, filter)
+		objectResponse, err := mc.SingleItem(coll, filter)
 		assert.Nil(t, err)
 		assert.Equal(t, expectedObject, objectResponse)
 	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		objectResponse, err := mc.SingleItem(coll, object)
+		assert.Nil(t, objectResponse)
+		assert.ErrorIs(t, err, mc.ErrNotFound)
+	})
+
+	t.Run("not connected", func(t *testing.T) {
+		objectResponse, err := mc.SingleItem(nil, object)
+		assert.Nil(t, objectResponse)
+		assert.ErrorIs(t, err, mc.ErrNotConnected)
+	})
 }
 
 func TestFindManyItems(t *testing.T) {
@@ -59,7 +77,7 @@ func TestFindManyItems(t *testing.T) {
 	defer mt.Close()
 
 	mt.Run("success", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		// create the test objects
 		testObj1 := bson.D{
 			{"name", "john"},
@@ -76,7 +94,7 @@ func TestFindManyItems(t *testing.T) {
 		mt.AddMockResponses(first, second, killCursors)
 
 		filter := bson.D{{"name", "john"}}
-		objects, err := mc.FindManyItems(mc.Collection, filter)
+		objects, err := mc.FindManyItems(coll, filter)
 		assert.Nil(t, err)
 		assert.Equal(t, []bson.M{
 			{"name": "john", "email": "testEmail1"},
@@ -90,7 +108,7 @@ func TestAllItems(t *testing.T) {
 	defer mt.Close()
 
 	mt.Run("success", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		// create the test objects
 		testObj1 := bson.D{
 			{"name", "john"},
@@ -106,7 +124,7 @@ func TestAllItems(t *testing.T) {
 		killCursors := mtest.CreateCursorResponse(0, "foo.bar", mtest.NextBatch)
 		mt.AddMockResponses(first, second, killCursors)
 
-		objects, err := mc.AllItems(mc.Collection)
+		objects, err := mc.AllItems(coll)
 		assert.Nil(t, err)
 		assert.Equal(t, []bson.M{
 			{"name": "john", "email": "testEmail1"},
@@ -120,19 +138,19 @@ func TestRemoveOne(t *testing.T) {
 	defer mt.Close()
 
 	mt.Run("success", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		mt.AddMockResponses(bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 1}})
 		filter := bson.D{{"name", "john"}}
-		_, err := mc.RemoveOne(mc.Collection, filter)
+		_, err := mc.RemoveOne(coll, filter)
 		assert.Nil(t, err)
 
 	})
 
 	mt.Run("no document deleted", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		mt.AddMockResponses(bson.D{{"ok", 0}, {"acknowledged", true}, {"n", 0}})
 		filter := bson.D{{"name", "john"}}
-		_, err := mc.RemoveOne(mc.Collection, filter)
+		_, err := mc.RemoveOne(coll, filter)
 		assert.NotNil(t, err)
 
 	})
@@ -143,21 +161,21 @@ func TestRemoveMany(t *testing.T) {
 	defer mt.Close()
 
 	mt.Run("success", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		mt.AddMockResponses(bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 1}})
 
 		filter := interface{}(bson.D{{"name", "john"}})
-		_, err := mc.RemoveMany(mc.Collection, filter)
+		_, err := mc.RemoveMany(coll, filter)
 		fmt.Printf("%v\n", err)
 		assert.Nil(t, err)
 
 	})
 
 	mt.Run("no document deleted", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		mt.AddMockResponses(bson.D{{"ok", 0}, {"acknowledged", true}, {"n", 0}})
 		filter := interface{}(bson.D{{"name", "john"}})
-		_, err := mc.RemoveMany(mc.Collection, filter)
+		_, err := mc.RemoveMany(coll, filter)
 		assert.NotNil(t, err)
 
 	})
@@ -173,18 +191,18 @@ func TestCreateEntry(t *testing.T) {
 	// run a test on the mock client
 	mt.Run("success", func(mt *mtest.T) {
 		// specify the collection
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		// set up the mock
 		mt.AddMockResponses(mtest.CreateSuccessResponse())
 		// pass the mocks into the function under test
-		insertedID, err := mc.CreateEntry(mc.Collection, doc)
+		insertedID, err := mc.CreateEntry(coll, doc)
 		// assert the expected outcomes
 		assert.Nil(t, err)
 		assert.Equal(t, id, insertedID)
 	})
 
 	mt.Run("custom error duplicate", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
 			Index:   1,
 			Code:    11000,
@@ -193,23 +211,25 @@ func TestCreateEntry(t *testing.T) {
 		// create an empty doc
 		doc := bson.D{{}}
 
-		insertedID, err := mc.CreateEntry(mc.Collection, doc)
+		insertedID, err := mc.CreateEntry(coll, doc)
 		fmt.Printf("Returned error:%v\n", err)
 		assert.Nil(t, insertedID)
 		assert.NotNil(t, err)
-		// is "duplicate key error"  in the returned error string?
-		if !strings.Contains(fmt.Sprint(err), "duplicate key error") {
-			t.Errorf("not duplicate key error: %v", err)
+		// is the returned error a duplicate key error?
+		assert.ErrorIs(t, err, mc.ErrDuplicateKey)
+		var opErr *mc.OpError
+		if assert.ErrorAs(t, err, &opErr) {
+			assert.Equal(t, mc.OpCreateEntry, opErr.Op)
 		}
 	})
 
 	mt.Run("simple error", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		mt.AddMockResponses(bson.D{{"ok", 0}})
 		// create an empty doc
 		doc := bson.D{{}}
 
-		insertedID, err := mc.CreateEntry(mc.Collection, doc)
+		insertedID, err := mc.CreateEntry(coll, doc)
 		assert.Nil(t, insertedID)
 		assert.NotNil(t, err)
 	})
@@ -230,13 +250,324 @@ func TestCreateEntries(t *testing.T) {
 	}
 
 	mt.Run("success", func(mt *mtest.T) {
-		mc.Collection = mt.Coll
+		coll := mt.Coll
 		objects := []interface{}{testObj1, testObj2}
 		mt.AddMockResponses(mtest.CreateSuccessResponse())
 
-		results, err := mc.CreateEntries(mc.Collection, objects)
+		results, err := mc.CreateEntries(coll, objects)
 		assert.Nil(t, err)
 		assert.NotNil(t, results)
 
 	})
+
+	mt.Run("partly failed", func(mt *mtest.T) {
+		coll := mt.Coll
+		objects := []interface{}{testObj1, testObj2, bson.D{{"name", "jane"}}}
+		mt.AddMockResponses(bson.D{
+			{"ok", 1},
+			{"n", 2},
+			{"writeErrors", bson.A{bson.D{{"index", 1}, {"code", 11000}, {"errmsg", "duplicate key error"}}}},
+		})
+
+		ids, err := mc.CreateEntries(coll, objects)
+		assert.ErrorIs(t, err, mc.ErrDuplicateKey)
+		var batchErr *mc.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, []int{1}, batchErr.Failed())
+		assert.Len(t, ids, 3)
+		assert.NotNil(t, ids[0])
+		assert.Nil(t, ids[1])
+		assert.NotNil(t, ids[2])
+	})
+
+	mt.Run("ordered", func(mt *mtest.T) {
+		coll := mt.Coll
+		objects := []interface{}{testObj1, testObj2, bson.D{{"name", "jane"}}}
+		mt.AddMockResponses(bson.D{
+			{"ok", 1},
+			{"n", 1},
+			{"writeErrors", bson.A{bson.D{{"index", 1}, {"code", 11000}, {"errmsg", "duplicate key error"}}}},
+		})
+
+		ids, err := mc.CreateEntriesCtx(context.Background(), coll, objects, mc.WithOrdered())
+		assert.NotNil(t, err)
+		assert.NotNil(t, ids[0])
+		assert.Nil(t, ids[1])
+		assert.Nil(t, ids[2])
+		var batchErr *mc.BatchError
+		assert.ErrorAs(t, err, &batchErr)
+		// the record after the failure was not tried
+		assert.Equal(t, []int{1, 2}, batchErr.Failed())
+		assert.ErrorIs(t, batchErr.Errors[2], mc.ErrNotAttempted)
+	})
+}
+
+func TestFindManyItemsCtx(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		coll := mt.Coll
+		testObj := bson.D{
+			{"name", "john"},
+			{"email", "testEmail1"},
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, testObj))
+		// pass the caller's context into the function under test
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		objects, err := mc.FindManyItemsCtx(ctx, coll, bson.D{{"name", "john"}})
+		assert.Nil(t, err)
+		assert.Equal(t, []bson.M{
+			{"name": "john", "email": "testEmail1"},
+		}, objects)
+	})
+}
+
+func TestConfigDB(t *testing.T) {
+	t.Run("invalid connection string", func(t *testing.T) {
+		coll, shutdown, err := mc.ConfigDB("localhost:27017", "testdb", "numbers")
+		assert.Nil(t, coll)
+		assert.Nil(t, shutdown)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("missing database name", func(t *testing.T) {
+		_, _, err := mc.ConfigDB("mongodb://localhost:27017", "", "numbers")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("missing collection name", func(t *testing.T) {
+		_, _, err := mc.ConfigDB("mongodb://localhost:27017/testdb", "", "")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unreachable server", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		coll, shutdown, err := mc.ConfigDBCtx(ctx, "mongodb://127.0.0.1:1/testdb?serverSelectionTimeoutMS=200", "", "numbers")
+		assert.Nil(t, coll)
+		assert.Nil(t, shutdown)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestUpdateOne(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}})
+		filter := bson.D{{"name", "john"}}
+		update := bson.D{{"$set", bson.D{{"email", "testEmail1"}}}}
+		res, err := mc.UpdateOne(coll, filter, update)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.MatchedCount)
+		assert.Equal(t, int64(1), res.ModifiedCount)
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 0}})
+		filter := bson.D{{"name", "john"}}
+		update := bson.D{{"$set", bson.D{{"email", "testEmail1"}}}}
+		res, err := mc.UpdateOne(coll, filter, update)
+		assert.Nil(t, res)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestUpdateMany(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 3}, {"nModified", 2}})
+		filter := bson.D{{"name", "john"}}
+		update := bson.D{{"$set", bson.D{{"active", true}}}}
+		res, err := mc.UpdateMany(coll, filter, update)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), res.MatchedCount)
+		assert.Equal(t, int64(2), res.ModifiedCount)
+	})
+}
+
+func TestReplaceOne(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}})
+		filter := bson.D{{"name", "john"}}
+		replacement := bson.D{{"name", "john"}, {"email", "testEmail2"}}
+		res, err := mc.ReplaceOne(coll, filter, replacement)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.MatchedCount)
+		assert.Equal(t, int64(1), res.ModifiedCount)
+	})
+}
+
+func TestUpsert(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("inserted", func(mt *mtest.T) {
+		coll := mt.Coll
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(bson.D{
+			{"ok", 1},
+			{"n", 1},
+			{"nModified", 0},
+			{"upserted", bson.A{bson.D{{"index", 0}, {"_id", id}}}},
+		})
+		filter := bson.D{{"name", "john"}}
+		update := bson.D{{"$set", bson.D{{"email", "testEmail1"}}}}
+		res, err := mc.Upsert(coll, filter, update)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), res.MatchedCount)
+		assert.Equal(t, int64(1), res.UpsertedCount)
+		assert.Equal(t, id, res.UpsertedID)
+	})
+
+	mt.Run("updated", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}})
+		filter := bson.D{{"name", "john"}}
+		update := bson.D{{"$set", bson.D{{"email", "testEmail1"}}}}
+		res, err := mc.Upsert(coll, filter, update)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.ModifiedCount)
+		assert.Nil(t, res.UpsertedID)
+	})
+}
+
+func TestCount(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, bson.D{{"n", 3}}))
+		count, err := mc.Count(coll, bson.D{{"name", "john"}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), count)
+	})
+
+	mt.Run("query paging", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, bson.D{{"n", 5}}))
+		count, err := mc.Count(coll, mc.Where("name").Eq("john").Skip(10).Limit(5))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(5), count)
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline")
+		var stages []bson.D
+		assert.Nil(t, pipeline.Unmarshal(&stages))
+		assert.Equal(t, bson.D{{"$match", bson.D{{"name", "john"}}}}, stages[0])
+		assert.Equal(t, bson.D{{"$skip", int64(10)}}, stages[1])
+		assert.Equal(t, bson.D{{"$limit", int64(5)}}, stages[2])
+	})
+
+	mt.Run("invalid filter", func(mt *mtest.T) {
+		_, err := mc.Count(mt.Coll, "john")
+		assert.ErrorIs(t, err, mc.ErrInvalidFilter)
+	})
+}
+
+func TestEstimatedCount(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 42}})
+		count, err := mc.EstimatedCount(coll)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(42), count)
+	})
+}
+
+func TestExists(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("found", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, bson.D{{"n", 1}}))
+		exists, err := mc.Exists(coll, bson.D{{"email", "testEmail1"}})
+		assert.Nil(t, err)
+		assert.True(t, exists)
+	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		exists, err := mc.Exists(coll, bson.D{{"email", "nobody"}})
+		assert.Nil(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestDistinct(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("success", func(mt *mtest.T) {
+		coll := mt.Coll
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"values", bson.A{"john", "jane"}}})
+		values, err := mc.Distinct(coll, "name", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{"john", "jane"}, values)
+		assert.Equal(t, "name", mt.GetStartedEvent().Command.Lookup("key").StringValue())
+	})
+}
+
+// tagged is stored as a string by the registry of the client in
+// TestClientRegistry
+type tagged struct{ V int }
+
+func TestClientRegistry(t *testing.T) {
+	registry := bson.NewRegistryBuilder().
+		RegisterTypeEncoder(reflect.TypeOf(tagged{}), bsoncodec.ValueEncoderFunc(
+			func(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, _ reflect.Value) error {
+				return vw.WriteString("custom")
+			})).
+		Build()
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetRegistry(registry)))
+	defer mt.Close()
+	ctx := context.Background()
+
+	mt.Run("insert", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		_, err := mc.CreateEntryCtx(ctx, mt.Coll, bson.D{{"tag", tagged{1}}}, mc.WithRetry(mc.RetryPolicy{MaxAttempts: 2}))
+		assert.Nil(t, err)
+		assert.Equal(t, "custom", mt.GetStartedEvent().Command.Lookup("documents", "0", "tag").StringValue())
+
+		_, err = mc.CreateEntriesCtx(ctx, mt.Coll, []interface{}{bson.M{"tag": tagged{1}}})
+		assert.Nil(t, err)
+		assert.Equal(t, "custom", mt.GetStartedEvent().Command.Lookup("documents", "0", "tag").StringValue())
+	})
+
+	mt.Run("filter", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		filter := struct {
+			Tag tagged `bson:"tag"`
+		}{tagged{1}}
+		_, err := mc.RemoveManyCtx(ctx, mt.Coll, filter)
+		assert.Nil(t, err)
+		assert.Equal(t, "custom", mt.GetStartedEvent().Command.Lookup("deletes", "0", "q", "tag").StringValue())
+	})
+
+	mt.Run("batched insert", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		docs := []interface{}{struct {
+			Tag tagged `bson:"tag"`
+		}{tagged{1}}}
+		_, err := mc.CreateEntriesBatched(ctx, mt.Coll, docs, mc.BatchOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "custom", mt.GetStartedEvent().Command.Lookup("documents", "0", "tag").StringValue())
+	})
 }
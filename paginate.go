@@ -0,0 +1,173 @@
+package mongoconnect
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PageRequest selects the page FindPage returns. By default pages are read by
+// keyset, each page continuing after the last record of the previous one,
+// which stays fast on large collections:
+// page, err := FindPage[User](ctx, collection, filter, PageRequest{Size: 100})
+// next, err := FindPage[User](ctx, collection, filter, PageRequest{Size: 100, Token: page.NextToken})
+// Setting Number reads the numbered page with skip and limit instead.
+type PageRequest struct {
+	// Size is the number of records per page
+	Size int64
+	// SortKey is the field the records are ordered by, "_id" when empty. A
+	// "-" prefix orders descending. Records with the same key are ordered by
+	// _id.
+	SortKey string
+	// Token is the NextToken of the previous page, empty for the first page
+	Token string
+	// Number is the page to read with skip and limit, counting from 1, zero
+	// reads by keyset
+	Number int64
+}
+
+// Page is one page of records
+type Page[T any] struct {
+	Items []T
+	// NextToken continues keyset reading after this page, empty when there
+	// are no more records or the page was read by Number
+	NextToken string
+	// HasMore tells if records follow this page
+	HasMore bool
+	// Number is the page number for pages read by Number
+	Number int64
+}
+
+// pageToken is the decoded form of Page.NextToken
+type pageToken struct {
+	Key bson.RawValue `bson:"k"`
+	ID  bson.RawValue `bson:"id"`
+}
+
+// FindPage returns the page of records matching filter that req asks for,
+// decoded into T. A Query filter contributes its filter only, the order and
+// size of the page come from req.
+func FindPage[T any](ctx context.Context, collection *mongo.Collection, filter interface{}, req PageRequest, opts ...Option) (*Page[T], error) {
+	if req.Size <= 0 {
+		return nil, opError(OpFindPage, collection, filter, errors.New("page size must be positive"))
+	}
+	key, order := "_id", 1
+	if req.SortKey != "" {
+		key = strings.TrimPrefix(req.SortKey, "-")
+		if strings.HasPrefix(req.SortKey, "-") {
+			order = -1
+		}
+	}
+
+	cfg := resolve(opts)
+	page := &Page[T]{Number: req.Number}
+	err := run(ctx, cfg, OpFindPage, collection, filter, func(ctx context.Context, collection *mongo.Collection, filter interface{}) (int64, error) {
+		// a retry starts over
+		page.Items, page.HasMore, page.NextToken = nil, false, ""
+		findOpts := options.Find().SetLimit(req.Size + 1).SetCollation(cfg.Collation)
+		if key == "_id" {
+			findOpts.SetSort(bson.D{{Key: "_id", Value: order}})
+		} else {
+			findOpts.SetSort(bson.D{{Key: key, Value: order}, {Key: "_id", Value: order}})
+		}
+		if req.Number > 0 {
+			findOpts.SetSkip((req.Number - 1) * req.Size)
+		} else if req.Token != "" {
+			after, err := afterToken(req.Token, key, order)
+			if err != nil {
+				return 0, err
+			}
+			filter = bson.D{{Key: "$and", Value: bson.A{filter, after}}}
+		}
+
+		cur, err := collection.Find(ctx, filter, findOpts)
+		if err != nil {
+			return 0, err
+		}
+		defer cur.Close(ctx)
+
+		var last bson.Raw
+		for cur.Next(ctx) {
+			if int64(len(page.Items)) == req.Size {
+				// the extra record only tells there is more
+				page.HasMore = true
+				break
+			}
+			var item T
+			if err := cur.Decode(&item); err != nil {
+				return 0, fmt.Errorf("could not decode item: %w", err)
+			}
+			page.Items = append(page.Items, item)
+			last = append(last[:0], cur.Current...)
+		}
+		if err := cur.Err(); err != nil {
+			return 0, err
+		}
+		if page.HasMore && req.Number == 0 {
+			token, err := newToken(last, key)
+			if err != nil {
+				return 0, err
+			}
+			page.NextToken = token
+		}
+		return int64(len(page.Items)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// newToken returns the token continuing after the record(last) ordered by key
+func newToken(last bson.Raw, key string) (string, error) {
+	id, err := last.LookupErr("_id")
+	if err != nil {
+		return "", fmt.Errorf("could not read _id of the last item: %w", err)
+	}
+	value, err := last.LookupErr(strings.Split(key, ".")...)
+	if err != nil {
+		// a record without the key sorts as null
+		value = bson.RawValue{Type: bson.TypeNull}
+	}
+	raw, err := bson.Marshal(pageToken{Key: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// afterToken returns the filter matching the records that follow token in
+// the order of key
+func afterToken(token string, key string, order int) (bson.D, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	var t pageToken
+	if err := bson.Unmarshal(raw, &t); err != nil || t.ID.Type == 0 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	op := "$gt"
+	if order < 0 {
+		op = "$lt"
+	}
+	if key == "_id" {
+		return bson.D{{Key: "_id", Value: bson.D{{Key: op, Value: t.ID}}}}, nil
+	}
+	after := bson.D{{Key: key, Value: bson.D{{Key: op, Value: t.Key}}}}
+	if t.Key.Type == bson.TypeNull && order > 0 {
+		// null and missing keys sort first but $gt null matches nothing, the
+		// records after them are those with a key
+		after = bson.D{{Key: key, Value: bson.D{{Key: "$ne", Value: nil}}}}
+	}
+	return bson.D{{Key: "$or", Value: bson.A{
+		after,
+		bson.D{{Key: key, Value: t.Key}, {Key: "_id", Value: bson.D{{Key: op, Value: t.ID}}}},
+	}}}, nil
+}
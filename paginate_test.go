@@ -0,0 +1,107 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestFindPage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	users := []bson.D{
+		{{"_id", ids[0]}, {"name", "john"}, {"email", "testEmail1"}},
+		{{"_id", ids[1]}, {"name", "john"}, {"email", "testEmail2"}},
+		{{"_id", ids[2]}, {"name", "john"}, {"email", "testEmail3"}},
+	}
+	filter := bson.D{{"name", "john"}}
+
+	mt.Run("keyset", func(mt *mtest.T) {
+		// the first page asks for one record more than its size
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, users...))
+		page, err := mc.FindPage[mc.User](ctx, mt.Coll, filter, mc.PageRequest{Size: 2, SortKey: "-email"})
+		assert.Nil(t, err)
+		assert.Len(t, page.Items, 2)
+		assert.True(t, page.HasMore)
+		assert.NotEmpty(t, page.NextToken)
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(t, int64(3), cmd.Lookup("limit").Int64())
+		assert.Equal(t, int32(-1), cmd.Lookup("sort", "email").Int32())
+		assert.Equal(t, int32(-1), cmd.Lookup("sort", "_id").Int32())
+
+		// the next page continues after the last record of the first one
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, users[2]))
+		next, err := mc.FindPage[mc.User](ctx, mt.Coll, filter, mc.PageRequest{Size: 2, SortKey: "-email", Token: page.NextToken})
+		assert.Nil(t, err)
+		assert.Equal(t, []mc.User{{ID: ids[2], Name: "john", Email: "testEmail3"}}, next.Items)
+		assert.False(t, next.HasMore)
+		assert.Empty(t, next.NextToken)
+
+		after := mt.GetStartedEvent().Command.Lookup("filter", "$and", "1", "$or")
+		var clauses []bson.D
+		assert.Nil(t, after.Unmarshal(&clauses))
+		assert.Equal(t, []bson.D{
+			{{"email", bson.D{{"$lt", "testEmail2"}}}},
+			{{"email", "testEmail2"}, {"_id", bson.D{{"$lt", ids[1]}}}},
+		}, clauses)
+	})
+
+	mt.Run("null key", func(mt *mtest.T) {
+		// the records have no age, so the page ends on a null key
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, users[:2]...))
+		page, err := mc.FindPage[mc.User](ctx, mt.Coll, filter, mc.PageRequest{Size: 1, SortKey: "age"})
+		assert.Nil(t, err)
+		mt.GetStartedEvent()
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		_, err = mc.FindPage[mc.User](ctx, mt.Coll, filter, mc.PageRequest{Size: 1, SortKey: "age", Token: page.NextToken})
+		assert.Nil(t, err)
+		after := mt.GetStartedEvent().Command.Lookup("filter", "$and", "1", "$or")
+		var clauses []bson.D
+		assert.Nil(t, after.Unmarshal(&clauses))
+		// the records with an age follow those without
+		assert.Equal(t, []bson.D{
+			{{"age", bson.D{{"$ne", nil}}}},
+			{{"age", nil}, {"_id", bson.D{{"$gt", ids[0]}}}},
+		}, clauses)
+	})
+
+	mt.Run("collation", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		_, err := mc.FindPage[mc.User](ctx, mt.Coll, filter, mc.PageRequest{Size: 2},
+			mc.WithCollation(&options.Collation{Locale: "en_US", Strength: 1}))
+		assert.Nil(t, err)
+		assert.Equal(t, "en_US", mt.GetStartedEvent().Command.Lookup("collation", "locale").StringValue())
+	})
+
+	mt.Run("numbered", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, users[2]))
+		page, err := mc.FindPage[bson.M](ctx, mt.Coll, filter, mc.PageRequest{Size: 2, Number: 2})
+		assert.Nil(t, err)
+		assert.Len(t, page.Items, 1)
+		assert.Equal(t, int64(2), page.Number)
+		assert.False(t, page.HasMore)
+		assert.Equal(t, int64(2), mt.GetStartedEvent().Command.Lookup("skip").Int64())
+	})
+
+	mt.Run("invalid token", func(mt *mtest.T) {
+		page, err := mc.FindPage[mc.User](ctx, mt.Coll, filter, mc.PageRequest{Size: 2, Token: "not a token"})
+		assert.Nil(t, page)
+		assert.ErrorIs(t, err, mc.ErrInvalidToken)
+	})
+
+	mt.Run("invalid size", func(mt *mtest.T) {
+		_, err := mc.FindPage[mc.User](ctx, mt.Coll, filter, mc.PageRequest{})
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,231 @@
+package mongoconnect
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Query combines a filter with the sort, paging and projection of a find:
+// q := Where("name").Eq("john").And("age").Gt(30).Sort("-created").Limit(50).Project("name", "email")
+// items, err := FindManyItems(collection, q)
+// A Query is accepted wherever a filter is, helpers that delete or update use
+// its filter and ignore the rest, Count applies its skip and limit too. Every method returns a new Query
+// so a Query can be shared and extended safely.
+type Query struct {
+	filter     Filter
+	sort       bson.D
+	projection bson.D
+	skip       int64
+	limit      int64
+}
+
+// Condition is a condition on a field of a Query waiting for its operator
+type Condition struct {
+	query *Query
+	field string
+}
+
+// Where starts a Query with a condition on field
+func Where(field string) *Condition {
+	return (&Query{}).And(field)
+}
+
+// And adds a condition on field to the Query
+func (q *Query) And(field string) *Condition {
+	return &Condition{query: q, field: field}
+}
+
+// Eq matches records where the field equals value
+func (c *Condition) Eq(value interface{}) *Query {
+	return c.query.withFilter(c.query.filter.Eq(c.field, value))
+}
+
+// Ne matches records where the field does not equal value
+func (c *Condition) Ne(value interface{}) *Query {
+	return c.query.withFilter(c.query.filter.Ne(c.field, value))
+}
+
+// Gt matches records where the field is greater than value
+func (c *Condition) Gt(value interface{}) *Query {
+	return c.query.withFilter(c.query.filter.Gt(c.field, value))
+}
+
+// Gte matches records where the field is greater than or equal to value
+func (c *Condition) Gte(value interface{}) *Query {
+	return c.query.withFilter(c.query.filter.Gte(c.field, value))
+}
+
+// Lt matches records where the field is less than value
+func (c *Condition) Lt(value interface{}) *Query {
+	return c.query.withFilter(c.query.filter.Lt(c.field, value))
+}
+
+// Lte matches records where the field is less than or equal to value
+func (c *Condition) Lte(value interface{}) *Query {
+	return c.query.withFilter(c.query.filter.Lte(c.field, value))
+}
+
+// In matches records where the field equals one of values
+func (c *Condition) In(values ...interface{}) *Query {
+	return c.query.withFilter(c.query.filter.In(c.field, values...))
+}
+
+// Nin matches records where the field equals none of values
+func (c *Condition) Nin(values ...interface{}) *Query {
+	return c.query.withFilter(c.query.filter.Nin(c.field, values...))
+}
+
+// Exists matches records that have the field when exists is true, or lack it
+// when exists is false
+func (c *Condition) Exists(exists bool) *Query {
+	return c.query.withFilter(c.query.filter.Exists(c.field, exists))
+}
+
+// Or matches records matching the Query's conditions and the filter of any
+// of queries
+func (q *Query) Or(queries ...*Query) *Query {
+	filters := make([]Filter, len(queries))
+	for i, query := range queries {
+		filters[i] = query.filter
+	}
+	return q.withFilter(q.filter.Or(filters...))
+}
+
+// Sort orders the results by fields, a field prefixed with "-" sorts
+// descending
+func (q *Query) Sort(fields ...string) *Query {
+	out := q.clone()
+	out.sort = fieldSpec(fields, -1)
+	return out
+}
+
+// Skip skips the first n results
+func (q *Query) Skip(n int64) *Query {
+	out := q.clone()
+	out.skip = n
+	return out
+}
+
+// Limit returns at most n results, zero returns all of them
+func (q *Query) Limit(n int64) *Query {
+	out := q.clone()
+	out.limit = n
+	return out
+}
+
+// Project returns only fields of the results, fields prefixed with "-" are
+// left out instead
+func (q *Query) Project(fields ...string) *Query {
+	out := q.clone()
+	out.projection = fieldSpec(fields, 0)
+	return out
+}
+
+// Filter returns the filter document of the Query
+func (q *Query) Filter() bson.D {
+	if q.filter == nil {
+		return bson.D{}
+	}
+	return bson.D(q.filter)
+}
+
+// FindOptions returns the sort, paging and projection of the Query as find
+// options
+func (q *Query) FindOptions() *options.FindOptions {
+	opts := options.Find()
+	if q.sort != nil {
+		opts.SetSort(q.sort)
+	}
+	if q.projection != nil {
+		opts.SetProjection(q.projection)
+	}
+	if q.skip > 0 {
+		opts.SetSkip(q.skip)
+	}
+	if q.limit > 0 {
+		opts.SetLimit(q.limit)
+	}
+	return opts
+}
+
+// oneOptions returns the sort, skip and projection of the Query as find one
+// options
+func (q *Query) oneOptions() *options.FindOneOptions {
+	opts := options.FindOne()
+	if q.sort != nil {
+		opts.SetSort(q.sort)
+	}
+	if q.projection != nil {
+		opts.SetProjection(q.projection)
+	}
+	if q.skip > 0 {
+		opts.SetSkip(q.skip)
+	}
+	return opts
+}
+
+// withFilter returns a copy of the Query with filter
+func (q *Query) withFilter(filter Filter) *Query {
+	out := q.clone()
+	out.filter = filter
+	return out
+}
+
+// clone returns a copy of the Query
+func (q *Query) clone() *Query {
+	out := *q
+	return &out
+}
+
+// countOptions returns the skip and limit of the Query as count options
+func (q *Query) countOptions() *options.CountOptions {
+	opts := options.Count()
+	if q.skip > 0 {
+		opts.SetSkip(q.skip)
+	}
+	if q.limit > 0 {
+		opts.SetLimit(q.limit)
+	}
+	return opts
+}
+
+// fieldSpec turns fields into a sort or projection document, fields prefixed
+// with "-" get the value excluded and the others 1
+func fieldSpec(fields []string, excluded int) bson.D {
+	spec := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			spec = append(spec, bson.E{Key: field[1:], Value: excluded})
+			continue
+		}
+		spec = append(spec, bson.E{Key: field, Value: 1})
+	}
+	return spec
+}
+
+// findOptions returns the find options filter asks for when it is a Query
+func findOptions(filter interface{}) *options.FindOptions {
+	if q, ok := filter.(*Query); ok && q != nil {
+		return q.FindOptions()
+	}
+	return options.Find()
+}
+
+// findOneOptions returns the find one options filter asks for when it is a
+// Query
+func findOneOptions(filter interface{}) *options.FindOneOptions {
+	if q, ok := filter.(*Query); ok && q != nil {
+		return q.oneOptions()
+	}
+	return options.FindOne()
+}
+
+// countOptions returns the count options filter asks for when it is a Query
+func countOptions(filter interface{}) *options.CountOptions {
+	if q, ok := filter.(*Query); ok && q != nil {
+		return q.countOptions()
+	}
+	return options.Count()
+}
@@ -0,0 +1,95 @@
+package mongoconnect_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestQuery(t *testing.T) {
+	q := mc.Where("name").Eq("john").And("age").Gt(30).Sort("-created").Limit(50).Project("name", "email")
+
+	assert.Equal(t, bson.D{
+		{"name", "john"},
+		{"age", bson.D{{"$gt", 30}}},
+	}, q.Filter())
+
+	opts := q.FindOptions()
+	assert.Equal(t, bson.D{{"created", -1}}, opts.Sort)
+	assert.Equal(t, bson.D{{"name", 1}, {"email", 1}}, opts.Projection)
+	assert.Equal(t, int64(50), *opts.Limit)
+	assert.Nil(t, opts.Skip)
+
+	t.Run("queries are not changed by extending them", func(t *testing.T) {
+		base := mc.Where("name").Eq("john")
+		paged := base.Skip(10).And("age").Lte(40)
+		assert.Equal(t, bson.D{{"name", "john"}}, base.Filter())
+		assert.Nil(t, base.FindOptions().Skip)
+		assert.Equal(t, bson.D{{"name", "john"}, {"age", bson.D{{"$lte", 40}}}}, paged.Filter())
+		assert.Equal(t, int64(10), *paged.FindOptions().Skip)
+	})
+
+	t.Run("or and exclusion", func(t *testing.T) {
+		q := mc.Where("active").Eq(true).Or(
+			mc.Where("role").In("admin", "owner"),
+			mc.Where("email").Exists(false),
+		).Project("-password")
+		assert.Equal(t, bson.D{
+			{"active", true},
+			{"$or", bson.A{
+				bson.D{{"role", bson.D{{"$in", bson.A{"admin", "owner"}}}}},
+				bson.D{{"email", bson.D{{"$exists", false}}}},
+			}},
+		}, q.Filter())
+		assert.Equal(t, bson.D{{"password", 0}}, q.FindOptions().Projection)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		assert.Equal(t, bson.D{}, (&mc.Query{}).Filter())
+	})
+}
+
+func TestFindManyItemsQuery(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("server", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, bson.D{{"name", "john"}}))
+		q := mc.Where("name").Eq("john").Sort("-age").Skip(5).Limit(2).Project("name")
+		items, err := mc.FindManyItems(mt.Coll, q)
+		assert.Nil(t, err)
+		assert.Equal(t, []bson.M{{"name": "john"}}, items)
+
+		cmd := mt.GetStartedEvent().Command
+		assert.Equal(t, "john", cmd.Lookup("filter", "name").StringValue())
+		assert.Equal(t, int32(-1), cmd.Lookup("sort", "age").Int32())
+		assert.Equal(t, int64(5), cmd.Lookup("skip").Int64())
+		assert.Equal(t, int64(2), cmd.Lookup("limit").Int64())
+		assert.Equal(t, int32(1), cmd.Lookup("projection", "name").Int32())
+	})
+
+	t.Run("memory store", func(t *testing.T) {
+		store := mc.NewMemoryStore()
+		coll := newTestCollection(t, "users")
+		_, err := store.CreateEntries(coll, []interface{}{
+			bson.D{{"name", "john"}, {"age", 30}},
+			bson.D{{"name", "john"}, {"age", 50}},
+			bson.D{{"name", "john"}, {"age", 40}},
+			bson.D{{"name", "jane"}, {"age", 60}},
+		})
+		assert.Nil(t, err)
+
+		q := mc.Where("name").Eq("john").Sort("-age").Skip(1).Limit(1).Project("-_id", "age")
+		items, err := store.FindManyItems(coll, q)
+		assert.Nil(t, err)
+		assert.Equal(t, []bson.M{{"age": int32(40)}}, items)
+
+		item, err := store.SingleItem(coll, mc.Where("name").Eq("john").Sort("age"))
+		assert.Nil(t, err)
+		assert.Equal(t, int32(30), item.Map()["age"])
+	})
+}
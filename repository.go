@@ -0,0 +1,67 @@
+package mongoconnect
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Repository gives typed access to the documents of a collection, results are
+// decoded directly into T, for example:
+// users := NewRepository[User](collection)
+// user, err := users.FindOne(ctx, bson.D{{"email", "john@example.com"}})
+type Repository[T any] struct {
+	collection *mongo.Collection
+	opts       []Option
+}
+
+// NewRepository returns a Repository of T backed by Collection(collection),
+// opts are applied to every operation of the repository
+func NewRepository[T any](collection *mongo.Collection, opts ...Option) *Repository[T] {
+	return &Repository[T]{collection: collection, opts: opts}
+}
+
+// Collection returns the collection backing the repository
+func (r *Repository[T]) Collection() *mongo.Collection {
+	return r.collection
+}
+
+// Insert adds a record(doc) to the collection and returns the id created
+func (r *Repository[T]) Insert(ctx context.Context, doc T) (interface{}, error) {
+	return insertOne(ctx, resolve(r.opts), r.collection, doc)
+}
+
+// InsertMany adds records(docs) to the collection and returns the id's created
+func (r *Repository[T]) InsertMany(ctx context.Context, docs []T) ([]interface{}, error) {
+	records := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		records[i] = doc
+	}
+	return CreateEntriesCtx(ctx, r.collection, records, r.opts...)
+}
+
+// FindOne returns the first record matching filter
+func (r *Repository[T]) FindOne(ctx context.Context, filter interface{}) (T, error) {
+	return findOne[T](ctx, resolve(r.opts), r.collection, filter)
+}
+
+// Find returns all the records matching filter
+func (r *Repository[T]) Find(ctx context.Context, filter interface{}) ([]T, error) {
+	return findAll[T](ctx, resolve(r.opts), OpFindManyItems, r.collection, filter)
+}
+
+// All returns every record in the collection
+func (r *Repository[T]) All(ctx context.Context) ([]T, error) {
+	return findAll[T](ctx, resolve(r.opts), OpAllItems, r.collection, bson.D{})
+}
+
+// DeleteOne deletes the first record matching filter
+func (r *Repository[T]) DeleteOne(ctx context.Context, filter interface{}) (*mongo.DeleteResult, error) {
+	return RemoveOneCtx(ctx, r.collection, filter, r.opts...)
+}
+
+// DeleteMany deletes all the records matching filter
+func (r *Repository[T]) DeleteMany(ctx context.Context, filter interface{}) (*mongo.DeleteResult, error) {
+	return RemoveManyCtx(ctx, r.collection, filter, r.opts...)
+}
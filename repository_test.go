@@ -0,0 +1,110 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestRepository(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	id1 := primitive.NewObjectID()
+	id2 := primitive.NewObjectID()
+	testObj1 := bson.D{
+		{"_id", id1},
+		{"name", "john"},
+		{"email", "testEmail1"},
+	}
+	testObj2 := bson.D{
+		{"_id", id2},
+		{"name", "john"},
+		{"email", "testEmail2"},
+	}
+
+	mt.Run("insert", func(mt *mtest.T) {
+		users := mc.NewRepository[mc.User](mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		insertedID, err := users.Insert(ctx, mc.User{ID: id1, Name: "john", Email: "testEmail1"})
+		assert.Nil(t, err)
+		assert.Equal(t, id1, insertedID)
+	})
+
+	mt.Run("insert many", func(mt *mtest.T) {
+		users := mc.NewRepository[mc.User](mt.Coll)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		insertedIDs, err := users.InsertMany(ctx, []mc.User{
+			{ID: id1, Name: "john", Email: "testEmail1"},
+			{ID: id2, Name: "john", Email: "testEmail2"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{id1, id2}, insertedIDs)
+	})
+
+	mt.Run("find one", func(mt *mtest.T) {
+		users := mc.NewRepository[mc.User](mt.Coll)
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, testObj1))
+
+		user, err := users.FindOne(ctx, bson.D{{"email", "testEmail1"}})
+		assert.Nil(t, err)
+		assert.Equal(t, mc.User{ID: id1, Name: "john", Email: "testEmail1"}, user)
+	})
+
+	mt.Run("find one not found", func(mt *mtest.T) {
+		users := mc.NewRepository[mc.User](mt.Coll)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+
+		user, err := users.FindOne(ctx, bson.D{{"email", "nobody"}})
+		assert.NotNil(t, err)
+		assert.Equal(t, mc.User{}, user)
+	})
+
+	mt.Run("find", func(mt *mtest.T) {
+		users := mc.NewRepository[mc.User](mt.Coll)
+		first := mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, testObj1)
+		second := mtest.CreateCursorResponse(1, "foo.bar", mtest.NextBatch, testObj2)
+		killCursors := mtest.CreateCursorResponse(0, "foo.bar", mtest.NextBatch)
+		mt.AddMockResponses(first, second, killCursors)
+
+		found, err := users.Find(ctx, bson.D{{"name", "john"}})
+		assert.Nil(t, err)
+		assert.Equal(t, []mc.User{
+			{ID: id1, Name: "john", Email: "testEmail1"},
+			{ID: id2, Name: "john", Email: "testEmail2"},
+		}, found)
+	})
+
+	mt.Run("all", func(mt *mtest.T) {
+		users := mc.NewRepository[mc.User](mt.Coll)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, testObj1, testObj2))
+
+		found, err := users.All(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, found, 2)
+	})
+
+	mt.Run("delete", func(mt *mtest.T) {
+		users := mc.NewRepository[mc.User](mt.Coll)
+		mt.AddMockResponses(
+			bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 1}},
+			bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 2}},
+		)
+
+		res, err := users.DeleteOne(ctx, bson.D{{"email", "testEmail1"}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.DeletedCount)
+		res, err = users.DeleteMany(ctx, bson.D{{"name", "john"}})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), res.DeletedCount)
+	})
+}
@@ -0,0 +1,151 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// RetryPolicy runs an operation again when it fails on a transient error such
+// as an election or a lost connection. The zero RetryPolicy runs every
+// operation once. Set it for all helpers with Configure:
+// Configure(WithRetry(DefaultRetryPolicy()))
+// Every attempt gets the timeout of its operation, the waits between them are
+// bounded by the caller's context only. A write whose outcome is unknown, like
+// one that lost its connection, may have been applied before it is retried.
+// Inserted bson.D, bson.M and bson.Raw records without an _id get one before
+// the first attempt, a retry failing on that _id as a duplicate key counts the
+// record as added instead of adding it twice. Records of other types should
+// carry their own _id, and an update like $inc may be applied twice. Operations in a transaction, ForEach,
+// Stream and CreateEntriesBatched, whose chunks are retried on their own, are
+// never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the most times an operation runs, zero runs it once
+	MaxAttempts int
+	// Backoff is the wait before the first retry, it doubles for every next
+	// retry up to MaxBackoff
+	Backoff time.Duration
+	// MaxBackoff caps the wait between retries, zero leaves it uncapped
+	MaxBackoff time.Duration
+	// Jitter varies each wait randomly by up to this fraction of it, so
+	// clients failing together do not retry together
+	Jitter float64
+	// Retryable tells if an error is worth retrying, IsRetryable when nil
+	Retryable func(err error) bool
+	// OnRetry is called before every retry with the operation, the attempt
+	// that failed, its error and the wait before the next attempt
+	OnRetry func(op string, attempt int, err error, wait time.Duration)
+}
+
+// DefaultRetryPolicy returns a RetryPolicy of three attempts starting with a
+// 100ms backoff
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     100 * time.Millisecond,
+		MaxBackoff:  2 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// WithRetry sets the RetryPolicy of the operations
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Config) {
+		c.Retry = policy
+	}
+}
+
+// retryableCodes are the codes of server errors reporting a node that is not
+// or no longer the primary, shutting down or unreachable
+var retryableCodes = []int{6, 7, 89, 91, 189, 262, 9001, 10107, 11600, 11602, 13435, 13436}
+
+// IsRetryable reports whether err is a transient failure worth retrying: a
+// network error, no server being available, an error the server labels
+// RetryableWriteError or an error of a node stepping down or shutting down
+func IsRetryable(err error) bool {
+	var selectionErr topology.ServerSelectionError
+	if mongo.IsNetworkError(err) || errors.As(err, &selectionErr) || hasErrorLabel(err, "RetryableWriteError") {
+		return true
+	}
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	for _, code := range retryableCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// noRetry holds the operations that must not run twice
+var noRetry = map[string]bool{
+	OpForEach:              true,
+	OpCreateEntriesBatched: true,
+}
+
+// retry runs the operation(op) fn until it succeeds or the policy gives up,
+// it returns the error of the last attempt
+func (p RetryPolicy) retry(ctx context.Context, op string, fn func() error) error {
+	attempts := p.MaxAttempts
+	if noRetry[op] || inTransaction(ctx) {
+		attempts = 1
+	}
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		wait := p.backoff(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(op, attempt, err, wait)
+		}
+		logger().Warn("retrying mongo operation", "op", op, "attempt", attempt, "wait", wait, "error", err)
+		if !sleep(ctx, wait) {
+			return err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done, it reports whether d passed
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// backoff returns the wait after the failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(wait))
+	}
+	return wait
+}
+
+// inTransaction reports whether ctx runs a transaction, whose operations are
+// retried by WithTransaction as a whole
+func inTransaction(ctx context.Context) bool {
+	sess, ok := mongo.SessionFromContext(ctx).(mongo.XSession)
+	return ok && sess.ClientSession().TransactionRunning()
+}
@@ -0,0 +1,189 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, mc.IsRetryable(mongo.CommandError{Code: 189, Name: "PrimarySteppedDown"}))
+	assert.True(t, mc.IsRetryable(mongo.CommandError{Code: 1, Labels: []string{"RetryableWriteError"}}))
+	assert.True(t, mc.IsRetryable(mongo.CommandError{Labels: []string{"NetworkError"}}))
+	assert.False(t, mc.IsRetryable(mongo.CommandError{Code: 11000, Name: "DuplicateKey"}))
+	assert.False(t, mc.IsRetryable(errors.New("bad filter")))
+	assert.False(t, mc.IsRetryable(nil))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	steppedDown := mtest.CreateCommandErrorResponse(mtest.CommandError{
+		Code:    189,
+		Name:    "PrimarySteppedDown",
+		Message: "primary stepped down",
+	})
+	type retry struct {
+		op      string
+		attempt int
+	}
+
+	mt.Run("retried", func(mt *mtest.T) {
+		mt.AddMockResponses(steppedDown, steppedDown,
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		var retries []retry
+		res, err := mc.RemoveOneCtx(ctx, mt.Coll, bson.D{{"name", "john"}}, mc.WithRetry(mc.RetryPolicy{
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			OnRetry: func(op string, attempt int, err error, wait time.Duration) {
+				assert.True(t, mc.IsRetryable(err))
+				retries = append(retries, retry{op, attempt})
+			},
+		}))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), res.DeletedCount)
+		assert.Equal(t, []retry{{mc.OpRemoveOne, 1}, {mc.OpRemoveOne, 2}}, retries)
+	})
+
+	mt.Run("insert keeps its id", func(mt *mtest.T) {
+		mt.AddMockResponses(steppedDown, mtest.CreateSuccessResponse())
+		id, err := mc.CreateEntryCtx(ctx, mt.Coll, bson.D{{"name", "john"}}, mc.WithRetry(mc.RetryPolicy{MaxAttempts: 2}))
+		assert.Nil(t, err)
+		first := mt.GetStartedEvent().Command.Lookup("documents", "0", "_id")
+		second := mt.GetStartedEvent().Command.Lookup("documents", "0", "_id")
+		assert.Equal(t, first, second)
+		assert.Equal(t, first.ObjectID(), id)
+	})
+
+	mt.Run("insert added by a lost attempt", func(mt *mtest.T) {
+		mt.AddMockResponses(steppedDown, bson.D{
+			{"ok", 1},
+			{"n", 0},
+			{"writeErrors", bson.A{bson.D{{"index", 0}, {"code", 11000}, {"errmsg", "E11000 duplicate key error collection: foo.bar index: _id_ dup key: { _id: 1 }"}}}},
+		})
+		id, err := mc.CreateEntryCtx(ctx, mt.Coll, bson.D{{"name", "john"}}, mc.WithRetry(mc.RetryPolicy{MaxAttempts: 2}))
+		assert.Nil(t, err)
+		mt.GetStartedEvent()
+		assert.Equal(t, mt.GetStartedEvent().Command.Lookup("documents", "0", "_id").ObjectID(), id)
+	})
+
+	mt.Run("ordered inserts go on after a lost attempt", func(mt *mtest.T) {
+		// the first record was added by the attempt whose outcome was lost
+		mt.AddMockResponses(steppedDown, bson.D{
+			{"ok", 1},
+			{"n", 0},
+			{"writeErrors", bson.A{bson.D{{"index", 0}, {"code", 11000}, {"errmsg", "E11000 duplicate key error collection: foo.bar index: _id_ dup key: { _id: 1 }"}}}},
+		}, mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}))
+		docs := []interface{}{bson.D{{"name", "john"}}, bson.M{"name": "jane"}, bson.D{{"name", "joe"}}}
+		ids, err := mc.CreateEntriesCtx(ctx, mt.Coll, docs, mc.WithOrdered(), mc.WithRetry(mc.RetryPolicy{MaxAttempts: 2}))
+		assert.Nil(t, err)
+		mt.GetStartedEvent()
+		sent := mt.GetStartedEvent().Command.Lookup("documents")
+		assert.Equal(t, sent.Array().Index(0).Value().Document().Lookup("_id").ObjectID(), ids[0])
+		// the rest is sent again after the duplicate
+		rest := mt.GetStartedEvent().Command.Lookup("documents").Array()
+		values, _ := rest.Values()
+		assert.Len(t, values, 2)
+		assert.Equal(t, values[0].Document().Lookup("_id").ObjectID(), ids[1])
+		assert.NotNil(t, ids[2])
+	})
+
+	mt.Run("duplicate of another record", func(mt *mtest.T) {
+		// a duplicate on the first attempt is a real one
+		mt.AddMockResponses(bson.D{
+			{"ok", 1},
+			{"n", 0},
+			{"writeErrors", bson.A{bson.D{{"index", 0}, {"code", 11000}, {"errmsg", "E11000 duplicate key error collection: foo.bar index: _id_ dup key: { _id: 1 }"}}}},
+		})
+		_, err := mc.CreateEntryCtx(ctx, mt.Coll, bson.D{{"_id", 1}, {"name", "john"}}, mc.WithRetry(mc.RetryPolicy{MaxAttempts: 2}))
+		assert.ErrorIs(t, err, mc.ErrDuplicateKey)
+	})
+
+	mt.Run("gives up", func(mt *mtest.T) {
+		// the driver retries a read once on its own
+		mt.AddMockResponses(steppedDown, steppedDown, steppedDown, steppedDown)
+		var attempts int
+		_, err := mc.SingleItemCtx(ctx, mt.Coll, bson.D{{"name", "john"}}, mc.WithRetry(mc.RetryPolicy{
+			MaxAttempts: 2,
+			OnRetry: func(op string, attempt int, err error, wait time.Duration) {
+				attempts++
+			},
+		}))
+		var cmdErr mongo.CommandError
+		assert.True(t, errors.As(err, &cmdErr))
+		assert.Equal(t, int32(189), cmdErr.Code)
+		assert.Equal(t, 1, attempts)
+	})
+
+	mt.Run("not retryable", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Name: "BadValue", Message: "bad value"}))
+		var attempts int
+		_, err := mc.FindManyItemsCtx(ctx, mt.Coll, bson.D{{"name", "john"}}, mc.WithRetry(mc.RetryPolicy{
+			MaxAttempts: 3,
+			OnRetry: func(op string, attempt int, err error, wait time.Duration) {
+				attempts++
+			},
+		}))
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, attempts)
+	})
+
+	mt.Run("results start over", func(mt *mtest.T) {
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch, bson.D{{"name", "john"}}),
+			steppedDown,
+			// the killCursors of the failed cursor
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(1, ns, mtest.FirstBatch, bson.D{{"name", "john"}}),
+			mtest.CreateCursorResponse(0, ns, mtest.NextBatch, bson.D{{"name", "jane"}}),
+		)
+		items, err := mc.FindManyItemsCtx(ctx, mt.Coll, bson.D{}, mc.WithRetry(mc.RetryPolicy{MaxAttempts: 2}))
+		assert.Nil(t, err)
+		assert.Len(t, items, 2)
+	})
+
+	mt.Run("check connection", func(mt *mtest.T) {
+		mt.AddMockResponses(steppedDown, mtest.CreateSuccessResponse())
+		var attempts int
+		ok := mc.CheckConnectionCtx(ctx, mt.Client, mc.WithRetry(mc.RetryPolicy{
+			MaxAttempts: 2,
+			OnRetry: func(op string, attempt int, err error, wait time.Duration) {
+				assert.Equal(t, mc.OpCheckConnection, op)
+				attempts++
+			},
+		}))
+		assert.True(t, ok)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestRetryPolicyCancelled(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("stops waiting", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 189, Name: "PrimarySteppedDown", Message: "primary stepped down"}))
+		ctx, cancel := context.WithCancel(context.Background())
+		start := time.Now()
+		_, err := mc.RemoveManyCtx(ctx, mt.Coll, bson.D{}, mc.WithRetry(mc.RetryPolicy{
+			MaxAttempts: 2,
+			Backoff:     time.Minute,
+			OnRetry: func(op string, attempt int, err error, wait time.Duration) {
+				cancel()
+			},
+		}))
+		assert.NotNil(t, err)
+		assert.Less(t, time.Since(start), time.Minute)
+	})
+}
@@ -0,0 +1,78 @@
+package mongoconnect
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ForEach decodes the records matching filter into T one at a time and calls
+// fn with each of them, so only one record is held in memory. Iteration stops
+// when ctx is done or at the first error fn returns, that error can be found
+// in the returned error with errors.Is or errors.As:
+// err := ForEach(ctx, collection, filter, func(user User) error { return send(user) })
+// The sort, paging and projection of a Query filter are applied. ForEach has
+// no timeout by default, it runs until ctx is done.
+func ForEach[T any](ctx context.Context, collection *mongo.Collection, filter interface{}, fn func(doc T) error, opts ...Option) error {
+	cfg := resolve(opts)
+	findOpts := findOptions(filter).SetCollation(cfg.Collation)
+	return run(ctx, cfg, OpForEach, collection, filter, func(ctx context.Context, collection *mongo.Collection, filter interface{}) (int64, error) {
+		cur, err := collection.Find(ctx, filter, findOpts)
+		if err != nil {
+			return 0, err
+		}
+		defer cur.Close(ctx)
+		return decodeEach(ctx, cur, fn)
+	})
+}
+
+// Stream sends the records matching filter decoded into T on the returned
+// channel. At most buffer records are decoded ahead of the receiver, so a slow
+// receiver slows down the reading. The records channel is closed when all
+// records are sent, ctx is done or reading fails, the error is then sent on
+// the error channel:
+// users, errc := Stream[User](ctx, collection, filter, 100)
+// for user := range users { ... }
+// if err := <-errc; err != nil { ... }
+// A receiver stopping early must cancel ctx to release the cursor.
+func Stream[T any](ctx context.Context, collection *mongo.Collection, filter interface{}, buffer int, opts ...Option) (<-chan T, <-chan error) {
+	out := make(chan T, buffer)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(out)
+		err := ForEach(ctx, collection, filter, func(doc T) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			select {
+			case out <- doc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
+
+// decodeEach decodes the records of cur into T one at a time and passes them
+// to fn until fn fails, it returns the number of records passed
+func decodeEach[T any](ctx context.Context, cur *mongo.Cursor, fn func(doc T) error) (int64, error) {
+	var n int64
+	for cur.Next(ctx) {
+		var doc T
+		if err := cur.Decode(&doc); err != nil {
+			return n, fmt.Errorf("could not decode item: %w", err)
+		}
+		if err := fn(doc); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, cur.Err()
+}
@@ -0,0 +1,98 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestForEach(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+	users := []bson.D{
+		{{"_id", ids[0]}, {"name", "john"}, {"email", "testEmail1"}},
+		{{"_id", ids[1]}, {"name", "john"}, {"email", "testEmail2"}},
+		{{"_id", ids[2]}, {"name", "john"}, {"email", "testEmail3"}},
+	}
+
+	mt.Run("all batches", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, users[:2]...),
+			mtest.CreateCursorResponse(0, "foo.bar", mtest.NextBatch, users[2]),
+		)
+		var emails []string
+		err := mc.ForEach(ctx, mt.Coll, bson.D{{"name", "john"}}, func(user mc.User) error {
+			emails = append(emails, user.Email)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"testEmail1", "testEmail2", "testEmail3"}, emails)
+	})
+
+	mt.Run("stops on error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, users...))
+		stop := errors.New("stop")
+		var seen int
+		err := mc.ForEach(ctx, mt.Coll, nil, func(user mc.User) error {
+			seen++
+			if user.ID == ids[1] {
+				return stop
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, stop)
+		var opErr *mc.OpError
+		assert.ErrorAs(t, err, &opErr)
+		assert.Equal(t, mc.OpForEach, opErr.Op)
+		assert.Equal(t, 2, seen)
+	})
+
+	mt.Run("not connected", func(mt *mtest.T) {
+		err := mc.ForEach(ctx, nil, nil, func(user mc.User) error { return nil })
+		assert.ErrorIs(t, err, mc.ErrNotConnected)
+	})
+}
+
+func TestStream(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	users := []bson.D{
+		{{"_id", primitive.NewObjectID()}, {"name", "john"}, {"email", "testEmail1"}},
+		{{"_id", primitive.NewObjectID()}, {"name", "john"}, {"email", "testEmail2"}},
+		{{"_id", primitive.NewObjectID()}, {"name", "john"}, {"email", "testEmail3"}},
+	}
+
+	mt.Run("all records", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, users...))
+		items, errc := mc.Stream[bson.M](context.Background(), mt.Coll, bson.D{{"name", "john"}}, 1)
+		var emails []interface{}
+		for item := range items {
+			emails = append(emails, item["email"])
+		}
+		assert.Nil(t, <-errc)
+		assert.Equal(t, []interface{}{"testEmail1", "testEmail2", "testEmail3"}, emails)
+	})
+
+	mt.Run("receiver stops", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, users...))
+		ctx, cancel := context.WithCancel(context.Background())
+		items, errc := mc.Stream[mc.User](ctx, mt.Coll, nil, 0)
+		first := <-items
+		assert.Equal(t, "testEmail1", first.Email)
+		cancel()
+		for range items {
+		}
+		assert.ErrorIs(t, <-errc, context.Canceled)
+	})
+}
@@ -0,0 +1,94 @@
+package mongoconnect
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Error labels the server puts on errors of a transaction that can be retried
+const (
+	labelTransientTransaction = "TransientTransactionError"
+	labelUnknownCommitResult  = "UnknownTransactionCommitResult"
+)
+
+// abortTimeout bounds the abort of a failed transaction
+const abortTimeout = 2 * time.Second
+
+// transactionBackoff spaces the retries of a transaction and its commit, so a
+// struggling server is not hit back to back
+var transactionBackoff = RetryPolicy{
+	Backoff:    10 * time.Millisecond,
+	MaxBackoff: time.Second,
+	Jitter:     0.2,
+}
+
+// WithTransaction runs fn in a transaction on a new session of client and
+// commits it when fn succeeds. The helpers called with the session
+// context(sessCtx) run in the transaction:
+// err := WithTransaction(ctx, client, func(sessCtx mongo.SessionContext) error {
+// if _, err := RemoveOneCtx(sessCtx, accounts, filter); err != nil { return err }
+// _, err := CreateEntryCtx(sessCtx, archive, doc)
+// return err
+// })
+// The transaction is aborted when fn fails. When the server labels the failure
+// TransientTransactionError fn runs again in a new transaction, and a commit
+// labelled UnknownTransactionCommitResult is tried again, with a growing wait
+// between attempts until the timeout of OpTransaction expires. fn must
+// therefore be safe to run more than once.
+func WithTransaction(ctx context.Context, client *mongo.Client, fn func(sessCtx mongo.SessionContext) error, opts ...*options.TransactionOptions) error {
+	if client == nil {
+		return opError(OpTransaction, nil, nil, ErrNotConnected)
+	}
+	ctx, cancel := CurrentConfig().withTimeout(ctx, OpTransaction)
+	defer cancel()
+
+	sess, err := client.StartSession()
+	if err != nil {
+		return opError(OpTransaction, nil, nil, err)
+	}
+	defer sess.EndSession(ctx)
+
+	for attempt := 1; ; attempt++ {
+		err := runTransaction(ctx, sess, fn, opts)
+		if err == nil {
+			return nil
+		}
+		if !hasErrorLabel(err, labelTransientTransaction) || ctx.Err() != nil {
+			return opError(OpTransaction, nil, nil, err)
+		}
+		wait := transactionBackoff.backoff(attempt)
+		logger().Debug("retrying transaction", "op", OpTransaction, "attempt", attempt, "wait", wait, "error", err)
+		if !sleep(ctx, wait) {
+			return opError(OpTransaction, nil, nil, err)
+		}
+	}
+}
+
+// runTransaction runs fn in one transaction of sess and commits it
+func runTransaction(ctx context.Context, sess mongo.Session, fn func(sessCtx mongo.SessionContext) error, opts []*options.TransactionOptions) error {
+	if err := sess.StartTransaction(opts...); err != nil {
+		return err
+	}
+	sessCtx := mongo.NewSessionContext(ctx, sess)
+	if err := fn(sessCtx); err != nil {
+		// the abort gets its own time as ctx may be done already, the
+		// server aborts the transaction anyway when the abort fails
+		abortCtx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+		_ = sess.AbortTransaction(abortCtx)
+		cancel()
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := sess.CommitTransaction(sessCtx)
+		if err == nil {
+			return nil
+		}
+		if !hasErrorLabel(err, labelUnknownCommitResult) || ctx.Err() != nil || !sleep(ctx, transactionBackoff.backoff(attempt)) {
+			return fmt.Errorf("could not commit transaction: %w", err)
+		}
+	}
+}
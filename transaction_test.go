@@ -0,0 +1,104 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+func TestWithTransaction(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	mt.Run("commit", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+		err := mc.WithTransaction(ctx, mt.Client, func(sessCtx mongo.SessionContext) error {
+			_, err := mc.RemoveOneCtx(sessCtx, mt.Coll, bson.D{{"name", "john"}})
+			return err
+		})
+		assert.Nil(t, err)
+
+		// the helper runs in the transaction
+		started := mt.GetStartedEvent()
+		assert.Equal(t, "delete", started.CommandName)
+		assert.NotNil(t, started.Command.Lookup("lsid").Document())
+		assert.True(t, started.Command.Lookup("startTransaction").Boolean())
+		assert.Equal(t, "commitTransaction", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("retry transient", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{
+				Code:    112,
+				Name:    "WriteConflict",
+				Message: "write conflict",
+				Labels:  []string{"TransientTransactionError"},
+			}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+		var attempts int
+		err := mc.WithTransaction(ctx, mt.Client, func(sessCtx mongo.SessionContext) error {
+			attempts++
+			_, err := mc.RemoveOneCtx(sessCtx, mt.Coll, bson.D{{"name", "john"}})
+			return err
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, attempts)
+	})
+
+	mt.Run("retry unknown commit result", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{
+				Code:    91,
+				Name:    "ShutdownInProgress",
+				Message: "shutting down",
+				Labels:  []string{"UnknownTransactionCommitResult"},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+		var attempts int
+		err := mc.WithTransaction(ctx, mt.Client, func(sessCtx mongo.SessionContext) error {
+			attempts++
+			_, err := mc.RemoveOneCtx(sessCtx, mt.Coll, bson.D{{"name", "john"}})
+			return err
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	mt.Run("abort", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(),
+		)
+		failed := errors.New("failed")
+		err := mc.WithTransaction(ctx, mt.Client, func(sessCtx mongo.SessionContext) error {
+			if _, err := mc.RemoveOneCtx(sessCtx, mt.Coll, bson.D{{"name", "john"}}); err != nil {
+				return err
+			}
+			return failed
+		})
+		assert.ErrorIs(t, err, failed)
+		mt.GetStartedEvent()
+		assert.Equal(t, "abortTransaction", mt.GetStartedEvent().CommandName)
+	})
+
+	mt.Run("not connected", func(mt *mtest.T) {
+		err := mc.WithTransaction(ctx, nil, func(sessCtx mongo.SessionContext) error { return nil })
+		assert.ErrorIs(t, err, mc.ErrNotConnected)
+	})
+}
@@ -0,0 +1,254 @@
+package mongoconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Operation types of a ChangeEvent
+const (
+	OperationInsert     = "insert"
+	OperationUpdate     = "update"
+	OperationReplace    = "replace"
+	OperationDelete     = "delete"
+	OperationInvalidate = "invalidate"
+)
+
+// Watchable is anything changes can be watched on, *mongo.Collection,
+// *mongo.Database and *mongo.Client all are
+type Watchable interface {
+	Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+}
+
+// ChangeEvent is a change of a record delivered by Watch, FullDocument holds
+// the record decoded into T for inserts and replaces, and for updates when
+// WatchOptions.FullDocument is set
+type ChangeEvent[T any] struct {
+	// ResumeToken resumes the watch after this event
+	ResumeToken   bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	Namespace     struct {
+		Database   string `bson:"db"`
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey       bson.D              `bson:"documentKey"`
+	FullDocument      *T                  `bson:"fullDocument"`
+	UpdateDescription *UpdateDescription  `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+
+// UpdateDescription lists the fields an update changed
+type UpdateDescription struct {
+	UpdatedFields bson.D   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	// Pipeline filters or reshapes the events, for example
+	// Pipeline{}.Match(bson.D{{"operationType", "insert"}})
+	Pipeline Pipeline
+	// FullDocument looks up the current record for update events
+	FullDocument bool
+	// Store keeps the resume token of the last handled event under Name so a
+	// restarted watch continues where it stopped, no token is kept when nil
+	Store TokenStore
+	// Name is the key of the resume token in Store
+	Name string
+	// RetryDelay is the wait before resuming after a transient error, one
+	// second when zero
+	RetryDelay time.Duration
+}
+
+// Watch delivers the changes on target to handler one at a time until ctx is
+// done or handler fails:
+// err := Watch(ctx, collection, func(ctx context.Context, event ChangeEvent[User]) error {
+// return notify(event.FullDocument)
+// }, WatchOptions{Store: NewCollectionTokenStore(tokens), Name: "users-notifier"})
+// The resume token of each handled event is saved in the Store of opts, and a
+// watch starting with a saved token continues after it. Transient errors such
+// as a lost connection or an election resume the watch after RetryDelay. An
+// event whose handler fails is delivered again by the next watch.
+func Watch[T any](ctx context.Context, target Watchable, handler func(ctx context.Context, event ChangeEvent[T]) error, opts WatchOptions) error {
+	if target == nil || isNilPointer(target) {
+		return opError(OpWatch, nil, nil, ErrNotConnected)
+	}
+	if opts.Store != nil && opts.Name == "" {
+		return opError(OpWatch, nil, nil, errors.New("a token store needs a name"))
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	pipeline, err := opts.Pipeline.normalize()
+	if err != nil {
+		return opError(OpWatch, nil, nil, err)
+	}
+
+	var token bson.Raw
+	if opts.Store != nil {
+		if token, err = opts.Store.Load(ctx, opts.Name); err != nil {
+			return opError(OpWatch, nil, nil, fmt.Errorf("could not load resume token: %w", err))
+		}
+	}
+	for {
+		var handled bool
+		token, handled, err = watch(ctx, target, pipeline, token, handler, opts)
+		if ctx.Err() != nil {
+			return opError(OpWatch, nil, nil, ctx.Err())
+		}
+		if err == nil {
+			// the stream was invalidated, e.g. by dropping the collection
+			return nil
+		}
+		if !handled || !isResumable(err) {
+			return opError(OpWatch, nil, nil, err)
+		}
+		logger().Warn("resuming change stream", "op", OpWatch, "error", err)
+		select {
+		case <-ctx.Done():
+			return opError(OpWatch, nil, nil, ctx.Err())
+		case <-time.After(opts.RetryDelay):
+		}
+	}
+}
+
+// watch opens one change stream on target continuing after token and passes
+// its events to handler, it returns the token of the last handled event and
+// whether every event was handled
+func watch[T any](ctx context.Context, target Watchable, pipeline mongo.Pipeline, token bson.Raw, handler func(ctx context.Context, event ChangeEvent[T]) error, opts WatchOptions) (bson.Raw, bool, error) {
+	streamOpts := options.ChangeStream()
+	if opts.FullDocument {
+		streamOpts.SetFullDocument(options.UpdateLookup)
+	}
+	if token != nil {
+		streamOpts.SetResumeAfter(token)
+	}
+	stream, err := target.Watch(ctx, pipeline, streamOpts)
+	if err != nil {
+		return token, true, err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event ChangeEvent[T]
+		if err := stream.Decode(&event); err != nil {
+			return token, true, fmt.Errorf("could not decode change event: %w", err)
+		}
+		start := time.Now()
+		if err := handler(ctx, event); err != nil {
+			return token, false, err
+		}
+		token = stream.ResumeToken()
+		if opts.Store != nil {
+			if err := opts.Store.Save(ctx, opts.Name, token); err != nil {
+				return token, true, fmt.Errorf("could not save resume token: %w", err)
+			}
+		}
+		logger().Debug("change event", "op", OpWatch, "type", event.OperationType, "collection", event.Namespace.Collection, "duration", time.Since(start))
+	}
+	return token, true, stream.Err()
+}
+
+// isResumable reports whether a watch failing with err can be resumed
+func isResumable(err error) bool {
+	var selectionErr topology.ServerSelectionError
+	return mongo.IsNetworkError(err) ||
+		mongo.IsTimeout(err) ||
+		errors.As(err, &selectionErr) ||
+		hasErrorLabel(err, "ResumableChangeStreamError")
+}
+
+// isNilPointer reports whether target is a typed nil such as a nil
+// *mongo.Collection
+func isNilPointer(target Watchable) bool {
+	switch t := target.(type) {
+	case *mongo.Collection:
+		return t == nil
+	case *mongo.Database:
+		return t == nil
+	case *mongo.Client:
+		return t == nil
+	}
+	return false
+}
+
+// TokenStore keeps the resume tokens of watches by name
+type TokenStore interface {
+	// Load returns the token saved under name, nil when there is none
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	// Save saves token under name
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+// MemoryTokenStore keeps resume tokens in memory, so a watch resumes after
+// transient errors but not after a restart
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]bson.Raw
+}
+
+// NewMemoryTokenStore returns an empty MemoryTokenStore
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]bson.Raw)}
+}
+
+// Load returns the token saved under name
+func (s *MemoryTokenStore) Load(_ context.Context, name string) (bson.Raw, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[name], nil
+}
+
+// Save saves token under name
+func (s *MemoryTokenStore) Save(_ context.Context, name string, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[name] = append(bson.Raw(nil), token...)
+	return nil
+}
+
+// CollectionTokenStore keeps resume tokens in a collection as records
+// {_id: name, token: token}, so a watch resumes after a restart
+type CollectionTokenStore struct {
+	collection *mongo.Collection
+}
+
+// NewCollectionTokenStore returns a CollectionTokenStore keeping the tokens in
+// Collection(collection)
+func NewCollectionTokenStore(collection *mongo.Collection) *CollectionTokenStore {
+	return &CollectionTokenStore{collection: collection}
+}
+
+// storedToken is a record of a CollectionTokenStore
+type storedToken struct {
+	Name  string   `bson:"_id"`
+	Token bson.Raw `bson:"token"`
+}
+
+// Load returns the token saved under name
+func (s *CollectionTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	stored, err := findOne[storedToken](ctx, CurrentConfig(), s.collection, bson.D{{Key: "_id", Value: name}})
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stored.Token, nil
+}
+
+// Save saves token under name
+func (s *CollectionTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "token", Value: token}}}}
+	_, err := UpsertCtx(ctx, s.collection, bson.D{{Key: "_id", Value: name}}, update)
+	return err
+}
@@ -0,0 +1,150 @@
+package mongoconnect_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	mc "github.com/pienaahj/mongoconnect"
+)
+
+// changeEvent returns an insert event of user with the resume token(token)
+func changeEvent(token string, user bson.D) bson.D {
+	return bson.D{
+		{"_id", bson.D{{"_data", token}}},
+		{"operationType", "insert"},
+		{"ns", bson.D{{"db", "foo"}, {"coll", "bar"}}},
+		{"documentKey", bson.D{user[0]}},
+		{"fullDocument", user},
+	}
+}
+
+func TestWatch(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	users := []bson.D{
+		{{"_id", primitive.NewObjectID()}, {"name", "john"}, {"email", "testEmail1"}},
+		{{"_id", primitive.NewObjectID()}, {"name", "jane"}, {"email", "testEmail2"}},
+	}
+
+	mt.Run("events", func(mt *mtest.T) {
+		store := mc.NewMemoryTokenStore()
+		start, _ := bson.Marshal(bson.D{{"_data", "0"}})
+		assert.Nil(t, store.Save(ctx, "users", start))
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch,
+			changeEvent("1", users[0]), changeEvent("2", users[1])))
+		var emails []string
+		err := mc.Watch(ctx, mt.Coll, func(ctx context.Context, event mc.ChangeEvent[mc.User]) error {
+			assert.Equal(t, mc.OperationInsert, event.OperationType)
+			assert.Equal(t, "bar", event.Namespace.Collection)
+			emails = append(emails, event.FullDocument.Email)
+			return nil
+		}, mc.WatchOptions{
+			Pipeline: mc.Pipeline{}.Match(mc.Filter{}.Eq("operationType", mc.OperationInsert)),
+			Store:    store,
+			Name:     "users",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"testEmail1", "testEmail2"}, emails)
+
+		// the watch continued after the saved token and saved the last one
+		pipeline := mt.GetStartedEvent().Command.Lookup("pipeline")
+		assert.Equal(t, "0", pipeline.Array().Index(0).Value().Document().Lookup("$changeStream", "resumeAfter", "_data").StringValue())
+		assert.Equal(t, "insert", pipeline.Array().Index(1).Value().Document().Lookup("$match", "operationType").StringValue())
+		token, err := store.Load(ctx, "users")
+		assert.Nil(t, err)
+		assert.Equal(t, "2", token.Lookup("_data").StringValue())
+	})
+
+	mt.Run("resume", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{
+				Code:    999,
+				Message: "interrupted",
+				Labels:  []string{"ResumableChangeStreamError"},
+			}),
+			mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch, changeEvent("1", users[0])),
+		)
+		var events int
+		err := mc.Watch(ctx, mt.Coll, func(ctx context.Context, event mc.ChangeEvent[bson.M]) error {
+			events++
+			return nil
+		}, mc.WatchOptions{RetryDelay: time.Millisecond})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, events)
+	})
+
+	mt.Run("handler fails", func(mt *mtest.T) {
+		store := mc.NewMemoryTokenStore()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch,
+			changeEvent("1", users[0]), changeEvent("2", users[1])))
+		failed := errors.New("failed")
+		err := mc.Watch(ctx, mt.Coll, func(ctx context.Context, event mc.ChangeEvent[mc.User]) error {
+			if event.FullDocument.Name == "jane" {
+				return failed
+			}
+			return nil
+		}, mc.WatchOptions{Store: store, Name: "users"})
+		assert.ErrorIs(t, err, failed)
+
+		// the failed event is delivered again by the next watch
+		token, _ := store.Load(ctx, "users")
+		assert.Equal(t, "1", token.Lookup("_data").StringValue())
+	})
+
+	mt.Run("fatal error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 280, Message: "fatal"}))
+		err := mc.Watch(ctx, mt.Coll, func(ctx context.Context, event mc.ChangeEvent[bson.M]) error {
+			return nil
+		}, mc.WatchOptions{})
+		var opErr *mc.OpError
+		assert.ErrorAs(t, err, &opErr)
+		assert.Equal(t, mc.OpWatch, opErr.Op)
+	})
+
+	mt.Run("invalid options", func(mt *mtest.T) {
+		handler := func(ctx context.Context, event mc.ChangeEvent[bson.M]) error { return nil }
+		err := mc.Watch(ctx, mt.Coll, handler, mc.WatchOptions{Store: mc.NewMemoryTokenStore()})
+		assert.NotNil(t, err)
+		err = mc.Watch(ctx, mt.Coll, handler, mc.WatchOptions{Pipeline: mc.Pipeline{}.Match(42)})
+		assert.ErrorIs(t, err, mc.ErrInvalidFilter)
+	})
+}
+
+func TestCollectionTokenStore(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	ctx := context.Background()
+
+	mt.Run("load and save", func(mt *mtest.T) {
+		store := mc.NewCollectionTokenStore(mt.Coll)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		token, err := store.Load(ctx, "users")
+		assert.Nil(t, err)
+		assert.Nil(t, token)
+
+		saved, _ := bson.Marshal(bson.D{{"_data", "1"}})
+		mt.AddMockResponses(bson.D{{"ok", 1}, {"n", 1}, {"nModified", 1}})
+		assert.Nil(t, store.Save(ctx, "users", saved))
+		mt.GetStartedEvent()
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		assert.Equal(t, "users", update.Lookup("q", "_id").StringValue())
+		assert.True(t, update.Lookup("upsert").Boolean())
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch,
+			bson.D{{"_id", "users"}, {"token", bson.Raw(saved)}}))
+		token, err = store.Load(ctx, "users")
+		assert.Nil(t, err)
+		assert.Equal(t, bson.Raw(saved), token)
+	})
+}